@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/heptiolabs/healthcheck"
+)
+
+// Readiness adds details to the full readiness response (?full=1), which otherwise only carries the
+// result of each check
+type Readiness struct {
+	healthcheck.Handler
+	details func() map[string]string
+}
+
+func NewReadiness(handler healthcheck.Handler, details func() map[string]string) *Readiness {
+	return &Readiness{
+		Handler: handler,
+		details: details,
+	}
+}
+
+func (r *Readiness) ReadyEndpoint(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Query().Get("full") != "1" {
+		r.Handler.ReadyEndpoint(writer, request)
+		return
+	}
+	response := &bufferedResponse{header: writer.Header(), status: http.StatusOK}
+	r.Handler.ReadyEndpoint(response, request)
+	results := map[string]string{}
+	if err := json.Unmarshal(response.body.Bytes(), &results); err != nil {
+		writer.WriteHeader(response.status)
+		_, _ = writer.Write(response.body.Bytes())
+		return
+	}
+	for name, detail := range r.details() {
+		results[name] = detail
+	}
+	writer.WriteHeader(response.status)
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "    ")
+	_ = encoder.Encode(results)
+}
+
+// bufferedResponse keeps the response of the wrapped handler so the details can be added to its body
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
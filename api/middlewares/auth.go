@@ -18,18 +18,33 @@ const (
 
 // AuthInterceptor middleware for each rpc request. This function verifies the client has the correct AUTH TOKEN.
 func AuthInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// AuthStreamInterceptor middleware for each streaming rpc request. This function verifies the client has the correct AUTH TOKEN.
+func AuthStreamInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func authorize(ctx context.Context) error {
 	meta, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return nil, status.Error(codes.Unauthenticated, authError)
+		return status.Error(codes.Unauthenticated, authError)
 	}
 	authHeaderValue, ok := meta[headerAuthorizationKey]
 	if !ok {
-		return nil, status.Error(codes.Unauthenticated, authError)
+		return status.Error(codes.Unauthenticated, authError)
 	}
 	bearerToken := authHeaderValue[0]
 	if !strings.HasPrefix(bearerToken, tokenBearerPrefix) {
-		return nil, status.Error(codes.Unauthenticated, authError)
+		return status.Error(codes.Unauthenticated, authError)
 	}
 	// TODO: Perform the token validation here.
-	return handler(ctx, req)
+	return nil
 }
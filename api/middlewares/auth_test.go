@@ -49,3 +49,48 @@ func TestAuthInterceptor(t *testing.T) {
 		})
 	}
 }
+
+// GIVEN AuthStreamInterceptor
+func TestAuthStreamInterceptor(t *testing.T) {
+	tcs := []struct {
+		description string
+		incoming    context.Context
+		expectedErr error
+	}{
+		{
+			description: "WHEN there are no fields THEN Unauthenticated error",
+			incoming:    context.Background(),
+			expectedErr: status.Error(codes.Unauthenticated, authError),
+		},
+		{
+			description: "WHEN there is authorization field but not Bearer prefix THEN Unauthenticated error",
+			incoming:    metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "random")),
+			expectedErr: status.Error(codes.Unauthenticated, authError),
+		},
+		{
+			description: "WHEN there is authorization field with Bearer prefix THEN no error",
+			incoming:    metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer ***********")),
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			err := AuthStreamInterceptor(struct{}{}, &mockServerStream{ctx: tc.incoming}, &grpc.StreamServerInfo{}, func(any, grpc.ServerStream) error { return nil })
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// Mocked gRPC server stream
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return m.ctx
+}
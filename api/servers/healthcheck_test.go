@@ -1,6 +1,8 @@
 package servers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -8,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/heptiolabs/healthcheck"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -73,3 +76,65 @@ func TestHealthcheck(t *testing.T) {
 		})
 	}
 }
+
+// GIVEN Healthcheck with readiness details
+func TestHealthcheckReadinessDetails(t *testing.T) {
+	tcs := []struct {
+		description  string
+		query        string
+		check        error
+		expectedCode int
+		expectedBody map[string]string
+	}{
+		{
+			description:  "WHEN the full readiness is requested THEN the details follow the checks",
+			query:        "?full=1",
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]string{"check": "OK", "leading": "true"},
+		},
+		{
+			description:  "WHEN a check fails THEN the details are still reported",
+			query:        "?full=1",
+			check:        errors.New("not synced"),
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: map[string]string{"check": "not synced", "leading": "true"},
+		},
+		{
+			description:  "WHEN the readiness is requested THEN the body stays empty",
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]string{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			health := healthcheck.NewHandler()
+			health.AddReadinessCheck("check", func() error { return tc.check })
+			readiness := handlers.NewReadiness(health, func() map[string]string { return map[string]string{"leading": "true"} })
+			server := NewHealthcheck("", "12345", time.Minute, handlers.NewMetrics(&prometheus.Registry{}), readiness)
+			svr := httptest.NewServer(server.router)
+			defer svr.Close()
+
+			req, err := http.Get(svr.URL + "/.well-known/ready" + tc.query) //nolint:gosec,noctx // make test simple
+			if err != nil {
+				t.Fatalf("http get: %s", err)
+			}
+			defer func() {
+				if err := req.Body.Close(); err != nil {
+					t.Fatalf("closing body: %s", err)
+				}
+			}()
+
+			if tc.expectedCode != req.StatusCode {
+				t.Errorf("expected status code %v, but got %v", tc.expectedCode, req.StatusCode)
+			}
+			body := map[string]string{}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding body: %s", err)
+			}
+			if diff := cmp.Diff(tc.expectedBody, body); diff != "" {
+				t.Errorf("body has diff %s", diff)
+			}
+		})
+	}
+}
@@ -6,8 +6,32 @@ import (
 	"schwarz/services/kubernetes"
 
 	pb "schwarz/api/proto"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+var eventTypes = map[models.EventType]pb.PostgresEventType{
+	models.EventProvisioning: pb.PostgresEventType_POSTGRES_EVENT_TYPE_PROVISIONING,
+	models.EventPVCBound:     pb.PostgresEventType_POSTGRES_EVENT_TYPE_PVC_BOUND,
+	models.EventPodScheduled: pb.PostgresEventType_POSTGRES_EVENT_TYPE_POD_SCHEDULED,
+	models.EventReady:        pb.PostgresEventType_POSTGRES_EVENT_TYPE_READY,
+	models.EventDegraded:     pb.PostgresEventType_POSTGRES_EVENT_TYPE_DEGRADED,
+	models.EventDeleting:     pb.PostgresEventType_POSTGRES_EVENT_TYPE_DELETING,
+	models.EventDeleted:      pb.PostgresEventType_POSTGRES_EVENT_TYPE_DELETED,
+}
+
+var podRoles = map[models.PodRole]pb.PostgresPodRole{
+	models.RolePrimary:    pb.PostgresPodRole_POSTGRES_POD_ROLE_PRIMARY,
+	models.RoleReplica:    pb.PostgresPodRole_POSTGRES_POD_ROLE_REPLICA,
+	models.RoleStandalone: pb.PostgresPodRole_POSTGRES_POD_ROLE_STANDALONE,
+}
+
+var deleteResults = map[models.DeleteResult]pb.PostgresDeleteResult{
+	models.DeleteResultDeleted:  pb.PostgresDeleteResult_POSTGRES_DELETE_RESULT_DELETED,
+	models.DeleteResultNotFound: pb.PostgresDeleteResult_POSTGRES_DELETE_RESULT_NOT_FOUND,
+	models.DeleteResultFailed:   pb.PostgresDeleteResult_POSTGRES_DELETE_RESULT_FAILED,
+}
+
 type PostgresServer struct {
 	postgresService kubernetes.Service
 }
@@ -18,30 +42,253 @@ func NewPostgres(postgresService kubernetes.Service) pb.PostgresServiceServer {
 
 func (s *PostgresServer) CreatePostgres(ctx context.Context, req *pb.CreatePostgresRequest) (*pb.CreatePostgresResponse, error) {
 	resp, err := s.postgresService.Create(ctx, models.CreateRequest{
-		DBName:     req.GetDbName(),
-		UserName:   req.GetUserName(),
-		UserPass:   req.GetUserPass(),
-		PortNum:    req.GetPortNum(),
-		Replicas:   req.GetReplicas(),
-		Capacity:   req.GetCapacity(),
-		AccessMode: req.GetAccessMode(),
+		DBName:              req.GetDbName(),
+		UserName:            req.GetUserName(),
+		UserPass:            req.GetUserPass(),
+		PortNum:             req.GetPortNum(),
+		Replicas:            req.GetReplicas(),
+		Capacity:            req.GetCapacity(),
+		AccessMode:          req.GetAccessMode(),
+		Workload:            req.GetWorkload(),
+		StorageClass:        req.GetStorageClass(),
+		Namespace:           req.GetNamespace(),
+		Exposure:            req.GetExposure(),
+		ExposureAnnotations: req.GetExposureAnnotations(),
+		Resources:           getResourcesRequest(req.GetResources()),
+		Probes:              getProbesRequest(req.GetProbes()),
+		Image:               req.GetImage(),
+		AllowedClients: models.AllowedClients{
+			NamespaceSelectors: req.GetAllowedClients().GetNamespaceSelectors(),
+			PodSelectors:       req.GetAllowedClients().GetPodSelectors(),
+			CIDRs:              req.GetAllowedClients().GetCidrs(),
+		},
+		Scheduling: getSchedulingRequest(req.GetScheduling()),
+		Owner:      req.GetOwner(),
+		RequestID:  req.GetRequestId(),
 	})
 	return &pb.CreatePostgresResponse{
-		Id: resp.ID,
+		Id:        resp.ID,
+		Namespace: resp.Namespace,
+		Endpoint:  getEndpoint(resp.Endpoint),
 	}, err
 }
 
+func (s *PostgresServer) GetPostgres(ctx context.Context, req *pb.GetPostgresRequest) (*pb.GetPostgresResponse, error) {
+	resp, err := s.postgresService.Get(ctx, models.GetRequest{
+		ID:        req.GetId(),
+		Namespace: req.GetNamespace(),
+	})
+	if err != nil {
+		return &pb.GetPostgresResponse{}, err
+	}
+	pods := make([]*pb.PostgresPod, len(resp.Pods))
+	for idx, pod := range resp.Pods {
+		pods[idx] = &pb.PostgresPod{
+			Name:  pod.Name,
+			Role:  podRoles[pod.Role],
+			Ready: pod.Ready,
+		}
+	}
+	return &pb.GetPostgresResponse{
+		Id:                resp.ID,
+		Namespace:         resp.Namespace,
+		DbName:            resp.DBName,
+		PortNum:           resp.PortNum,
+		Replicas:          resp.Replicas,
+		Capacity:          resp.Capacity,
+		AccessMode:        resp.AccessMode,
+		ReadyReplicas:     resp.ReadyReplicas,
+		AvailableReplicas: resp.AvailableReplicas,
+		NodePort:          resp.NodePort,
+		Workload:          resp.Workload,
+		ReadOnlyNodePort:  resp.ReadOnlyNodePort,
+		StorageClass:      resp.StorageClass,
+		Image:             resp.Image,
+		Pods:              pods,
+		Endpoint:          getEndpoint(resp.Endpoint),
+		ReadOnlyEndpoint:  getEndpoint(resp.ReadOnlyEndpoint),
+		Resources:         getResources(resp.Resources),
+		Probes:            getProbes(resp.Probes),
+		CreatedAt:         timestamppb.New(resp.CreatedAt),
+	}, nil
+}
+
+func (s *PostgresServer) ListPostgres(ctx context.Context, req *pb.ListPostgresRequest) (*pb.ListPostgresResponse, error) {
+	resp, err := s.postgresService.List(ctx, models.ListRequest{
+		PageSize:      int64(req.GetPageSize()),
+		PageToken:     req.GetPageToken(),
+		LabelSelector: req.GetLabelSelector(),
+		Owner:         req.GetOwner(),
+		Namespace:     req.GetNamespace(),
+	})
+	if err != nil {
+		return &pb.ListPostgresResponse{}, err
+	}
+	instances := make([]*pb.PostgresSummary, len(resp.Instances))
+	for idx, instance := range resp.Instances {
+		instances[idx] = &pb.PostgresSummary{
+			Id:                instance.ID,
+			Namespace:         instance.Namespace,
+			Owner:             instance.Owner,
+			PortNum:           instance.PortNum,
+			Replicas:          instance.Replicas,
+			ReadyReplicas:     instance.ReadyReplicas,
+			AvailableReplicas: instance.AvailableReplicas,
+			Workload:          instance.Workload,
+			CreatedAt:         timestamppb.New(instance.CreatedAt),
+		}
+	}
+	return &pb.ListPostgresResponse{
+		Instances:     instances,
+		NextPageToken: resp.NextPageToken,
+	}, nil
+}
+
+func (s *PostgresServer) WatchPostgres(req *pb.WatchPostgresRequest, stream pb.PostgresService_WatchPostgresServer) error {
+	events, err := s.postgresService.Watch(stream.Context(), models.WatchRequest{
+		ID:        req.GetId(),
+		Namespace: req.GetNamespace(),
+	})
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		if err := stream.Send(&pb.WatchPostgresResponse{
+			Id:        event.ID,
+			Type:      eventTypes[event.Type],
+			Object:    event.Object,
+			Message:   event.Message,
+			Timestamp: timestamppb.New(event.Timestamp),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *PostgresServer) UpdatePostgres(ctx context.Context, req *pb.UpdatePostgresRequest) (*pb.UpdatePostgresResponse, error) {
 	err := s.postgresService.Update(ctx, models.UpdateRequest{
-		ID:       req.GetId(),
-		Replicas: req.GetReplicas(),
+		ID:         req.GetId(),
+		Namespace:  req.GetNamespace(),
+		UpdateMask: req.GetUpdateMask().GetPaths(),
+		Replicas:   req.GetReplicas(),
+		PortNum:    req.GetPortNum(),
+		UserName:   req.GetUserName(),
+		UserPass:   req.GetUserPass(),
+		Capacity:   req.GetCapacity(),
+		ImageTag:   req.GetImageTag(),
+		Image:      req.GetImage(),
+		Resources:  getResourcesRequest(req.GetResources()),
 	})
 	return &pb.UpdatePostgresResponse{}, err
 }
 
 func (s *PostgresServer) DeletePostgres(ctx context.Context, req *pb.DeletePostgresRequest) (*pb.DeletePostgresResponse, error) {
-	err := s.postgresService.Delete(ctx, models.DeleteRequest{
-		ID: req.GetId(),
+	resp, err := s.postgresService.Delete(ctx, models.DeleteRequest{
+		ID:        req.GetId(),
+		Namespace: req.GetNamespace(),
 	})
-	return &pb.DeletePostgresResponse{}, err
+	objects := make([]*pb.PostgresDeletedObject, len(resp.Objects))
+	for idx, object := range resp.Objects {
+		objects[idx] = &pb.PostgresDeletedObject{
+			Kind:   object.Kind,
+			Name:   object.Name,
+			Result: deleteResults[object.Result],
+			Error:  object.Error,
+		}
+	}
+	return &pb.DeletePostgresResponse{Objects: objects}, err
+}
+
+func (s *PostgresServer) GetPostgresDrift(ctx context.Context, req *pb.GetPostgresDriftRequest) (*pb.GetPostgresDriftResponse, error) {
+	resp, err := s.postgresService.Drift(ctx, models.DriftRequest{
+		ID:        req.GetId(),
+		Namespace: req.GetNamespace(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]*pb.PostgresDriftedObject, len(resp.Objects))
+	for idx, object := range resp.Objects {
+		objects[idx] = &pb.PostgresDriftedObject{
+			Kind:         object.Kind,
+			Name:         object.Name,
+			Missing:      object.Missing,
+			Fields:       object.Fields,
+			LegacyFields: object.LegacyFields,
+		}
+	}
+	return &pb.GetPostgresDriftResponse{Objects: objects}, nil
+}
+
+func getEndpoint(endpoint models.Endpoint) *pb.PostgresEndpoint {
+	return &pb.PostgresEndpoint{
+		Exposure:        endpoint.Exposure,
+		DnsName:         endpoint.DNSName,
+		Port:            endpoint.Port,
+		NodePort:        endpoint.NodePort,
+		ExternalAddress: endpoint.ExternalAddress,
+	}
+}
+
+func getResources(resources models.Resources) *pb.PostgresResources {
+	return &pb.PostgresResources{
+		CpuRequest:    resources.CPURequest,
+		CpuLimit:      resources.CPULimit,
+		MemoryRequest: resources.MemoryRequest,
+		MemoryLimit:   resources.MemoryLimit,
+	}
+}
+
+func getResourcesRequest(resources *pb.PostgresResources) models.Resources {
+	return models.Resources{
+		CPURequest:    resources.GetCpuRequest(),
+		CPULimit:      resources.GetCpuLimit(),
+		MemoryRequest: resources.GetMemoryRequest(),
+		MemoryLimit:   resources.GetMemoryLimit(),
+	}
+}
+
+func getProbes(probes models.Probes) *pb.PostgresProbes {
+	return &pb.PostgresProbes{
+		PeriodSeconds:         probes.PeriodSeconds,
+		TimeoutSeconds:        probes.TimeoutSeconds,
+		FailureThreshold:      probes.FailureThreshold,
+		StartupTimeoutSeconds: probes.StartupTimeoutSeconds,
+	}
+}
+
+func getProbesRequest(probes *pb.PostgresProbes) models.Probes {
+	return models.Probes{
+		PeriodSeconds:         probes.GetPeriodSeconds(),
+		TimeoutSeconds:        probes.GetTimeoutSeconds(),
+		FailureThreshold:      probes.GetFailureThreshold(),
+		StartupTimeoutSeconds: probes.GetStartupTimeoutSeconds(),
+	}
+}
+
+func getSchedulingRequest(scheduling *pb.PostgresScheduling) models.Scheduling {
+	request := models.Scheduling{
+		NodeSelector: scheduling.GetNodeSelector(),
+		AntiAffinity: models.AntiAffinity{
+			Topology: scheduling.GetAntiAffinity().GetTopology(),
+			Required: scheduling.GetAntiAffinity().GetRequired(),
+		},
+	}
+	for _, toleration := range scheduling.GetTolerations() {
+		request.Tolerations = append(request.Tolerations, models.Toleration{
+			Key:      toleration.GetKey(),
+			Operator: toleration.GetOperator(),
+			Value:    toleration.GetValue(),
+			Effect:   toleration.GetEffect(),
+		})
+	}
+	for _, spread := range scheduling.GetTopologySpread() {
+		request.TopologySpread = append(request.TopologySpread, models.TopologySpread{
+			Topology:          spread.GetTopology(),
+			MaxSkew:           spread.GetMaxSkew(),
+			WhenUnsatisfiable: spread.GetWhenUnsatisfiable(),
+		})
+	}
+	return request
 }
@@ -6,6 +6,13 @@ import (
 	pb "schwarz/api/proto"
 	"schwarz/models"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // GIVEN CreatePostgres
@@ -28,6 +35,18 @@ func TestCreatePostgres(t *testing.T) {
 				Replicas:   1,
 				Capacity:   "10Mi",
 				AccessMode: "ReadOnlyOnce",
+				RequestId:  "7f9c1c0e-retry-key",
+				Exposure:   "loadbalancer",
+				ExposureAnnotations: map[string]string{
+					"service.beta.kubernetes.io/aws-load-balancer-internal": "true",
+				},
+				Resources: &pb.PostgresResources{CpuRequest: "500m", MemoryLimit: "2Gi"},
+				Probes:    &pb.PostgresProbes{StartupTimeoutSeconds: 600},
+				Image:     "16",
+				AllowedClients: &pb.PostgresAllowedClients{
+					NamespaceSelectors: []string{"team=payments"},
+					Cidrs:              []string{"10.0.0.0/8"},
+				},
 			},
 			forcedResult:   "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
 			forcedError:    nil,
@@ -76,6 +95,30 @@ func TestCreatePostgres(t *testing.T) {
 					if request.UserPass != tc.incoming.UserPass {
 						t.Errorf("expected UserPass = %s, received = %s", tc.incoming.UserPass, request.UserPass)
 					}
+					if request.Owner != tc.incoming.Owner {
+						t.Errorf("expected Owner = %s, received = %s", tc.incoming.Owner, request.Owner)
+					}
+					if request.RequestID != tc.incoming.RequestId {
+						t.Errorf("expected RequestID = %s, received = %s", tc.incoming.RequestId, request.RequestID)
+					}
+					if request.Exposure != tc.incoming.Exposure {
+						t.Errorf("expected Exposure = %s, received = %s", tc.incoming.Exposure, request.Exposure)
+					}
+					if diff := cmp.Diff(tc.incoming.ExposureAnnotations, request.ExposureAnnotations); diff != "" {
+						t.Errorf("exposure annotations have diff %s", diff)
+					}
+					if request.Resources.CPURequest != tc.incoming.GetResources().GetCpuRequest() || request.Resources.MemoryLimit != tc.incoming.GetResources().GetMemoryLimit() {
+						t.Errorf("expected Resources = %v, received = %v", tc.incoming.GetResources(), request.Resources)
+					}
+					if diff := cmp.Diff(tc.incoming.GetAllowedClients().GetCidrs(), request.AllowedClients.CIDRs); diff != "" {
+						t.Errorf("allowed CIDRs have diff %s", diff)
+					}
+					if request.Probes.StartupTimeoutSeconds != tc.incoming.GetProbes().GetStartupTimeoutSeconds() {
+						t.Errorf("expected StartupTimeoutSeconds = %d, received = %d", tc.incoming.GetProbes().GetStartupTimeoutSeconds(), request.Probes.StartupTimeoutSeconds)
+					}
+					if request.Image != tc.incoming.GetImage() {
+						t.Errorf("expected Image = %s, received = %s", tc.incoming.GetImage(), request.Image)
+					}
 					return models.CreateResponse{
 						ID: tc.forcedResult,
 					}, tc.forcedError
@@ -94,6 +137,303 @@ func TestCreatePostgres(t *testing.T) {
 	}
 }
 
+// GIVEN GetPostgres
+func TestGetPostgres(t *testing.T) {
+	tcs := []struct {
+		description    string
+		incoming       *pb.GetPostgresRequest
+		forcedResult   models.GetResponse
+		forcedError    error
+		expectedResult *pb.GetPostgresResponse
+		expectedError  error
+	}{
+		{
+			description: "WHEN incoming data is set without error THEN current data is processed and result given",
+			incoming: &pb.GetPostgresRequest{
+				Id: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+			},
+			forcedResult: models.GetResponse{
+				ID:                "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				DBName:            "dbName",
+				PortNum:           5432,
+				Replicas:          2,
+				Capacity:          "10Mi",
+				AccessMode:        "ReadWriteOnce",
+				ReadyReplicas:     1,
+				AvailableReplicas: 1,
+				NodePort:          30001,
+				Workload:          "statefulset",
+				ReadOnlyNodePort:  30002,
+				Pods: []models.PodStatus{
+					{Name: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b-0", Role: models.RolePrimary, Ready: true},
+					{Name: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b-1", Role: models.RoleReplica, Ready: false},
+				},
+				Endpoint: models.Endpoint{
+					Exposure: "nodeport",
+					DNSName:  "postgres-ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b.default.svc",
+					Port:     5432,
+					NodePort: 30001,
+				},
+				ReadOnlyEndpoint: models.Endpoint{
+					Exposure: "nodeport",
+					DNSName:  "postgres-ro-ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b.default.svc",
+					Port:     5432,
+					NodePort: 30002,
+				},
+				Resources: models.Resources{CPURequest: "250m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"},
+				Probes:    models.Probes{PeriodSeconds: 10, TimeoutSeconds: 5, FailureThreshold: 3, StartupTimeoutSeconds: 300},
+				CreatedAt: time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC),
+			},
+			forcedError: nil,
+			expectedResult: &pb.GetPostgresResponse{
+				Id:                "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				DbName:            "dbName",
+				PortNum:           5432,
+				Replicas:          2,
+				Capacity:          "10Mi",
+				AccessMode:        "ReadWriteOnce",
+				ReadyReplicas:     1,
+				AvailableReplicas: 1,
+				NodePort:          30001,
+				Workload:          "statefulset",
+				ReadOnlyNodePort:  30002,
+				Pods: []*pb.PostgresPod{
+					{Name: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b-0", Role: pb.PostgresPodRole_POSTGRES_POD_ROLE_PRIMARY, Ready: true},
+					{Name: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b-1", Role: pb.PostgresPodRole_POSTGRES_POD_ROLE_REPLICA, Ready: false},
+				},
+				Endpoint: &pb.PostgresEndpoint{
+					Exposure: "nodeport",
+					DnsName:  "postgres-ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b.default.svc",
+					Port:     5432,
+					NodePort: 30001,
+				},
+				ReadOnlyEndpoint: &pb.PostgresEndpoint{
+					Exposure: "nodeport",
+					DnsName:  "postgres-ro-ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b.default.svc",
+					Port:     5432,
+					NodePort: 30002,
+				},
+				Resources: &pb.PostgresResources{CpuRequest: "250m", CpuLimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"},
+				Probes:    &pb.PostgresProbes{PeriodSeconds: 10, TimeoutSeconds: 5, FailureThreshold: 3, StartupTimeoutSeconds: 300},
+				CreatedAt: timestamppb.New(time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)),
+			},
+			expectedError: nil,
+		},
+		{
+			description: "WHEN incoming data is set with error THEN current data is processed and error given",
+			incoming: &pb.GetPostgresRequest{
+				Id: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+			},
+			forcedError:   errors.New("random"),
+			expectedError: errors.New("random"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			postgresService := &mockPostgresService{
+				get: func(_ context.Context, request models.GetRequest) (models.GetResponse, error) {
+					if request.ID != tc.incoming.Id {
+						t.Errorf("expected ID = %s, received = %s", tc.incoming.Id, request.ID)
+					}
+					return tc.forcedResult, tc.forcedError
+				},
+			}
+			postgresServer := NewPostgres(postgresService)
+			result, err := postgresServer.GetPostgres(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedError != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedError == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedError, err)
+			} else if err == nil && !proto.Equal(result, tc.expectedResult) {
+				t.Errorf("expected result = %v, got %v", tc.expectedResult, result)
+			}
+		})
+	}
+}
+
+// GIVEN ListPostgres
+func TestListPostgres(t *testing.T) {
+	tcs := []struct {
+		description    string
+		incoming       *pb.ListPostgresRequest
+		forcedResult   models.ListResponse
+		forcedError    error
+		expectedResult *pb.ListPostgresResponse
+		expectedError  error
+	}{
+		{
+			description: "WHEN incoming data is set without error THEN current data is processed and result given",
+			incoming: &pb.ListPostgresRequest{
+				PageSize:      10,
+				PageToken:     "token",
+				LabelSelector: "tier=backend",
+				Owner:         "team-a",
+			},
+			forcedResult: models.ListResponse{
+				Instances: []models.InstanceSummary{{
+					ID:                "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Owner:             "team-a",
+					PortNum:           5432,
+					Replicas:          2,
+					ReadyReplicas:     2,
+					AvailableReplicas: 2,
+					CreatedAt:         time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC),
+				}},
+				NextPageToken: "next",
+			},
+			forcedError: nil,
+			expectedResult: &pb.ListPostgresResponse{
+				Instances: []*pb.PostgresSummary{{
+					Id:                "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Owner:             "team-a",
+					PortNum:           5432,
+					Replicas:          2,
+					ReadyReplicas:     2,
+					AvailableReplicas: 2,
+					CreatedAt:         timestamppb.New(time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)),
+				}},
+				NextPageToken: "next",
+			},
+			expectedError: nil,
+		},
+		{
+			description: "WHEN incoming data is set with error THEN current data is processed and error given",
+			incoming: &pb.ListPostgresRequest{
+				PageSize: 10,
+			},
+			forcedError:   errors.New("random"),
+			expectedError: errors.New("random"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			postgresService := &mockPostgresService{
+				list: func(_ context.Context, request models.ListRequest) (models.ListResponse, error) {
+					if request.PageSize != int64(tc.incoming.PageSize) {
+						t.Errorf("expected PageSize = %d, received = %d", tc.incoming.PageSize, request.PageSize)
+					}
+					if request.PageToken != tc.incoming.PageToken {
+						t.Errorf("expected PageToken = %s, received = %s", tc.incoming.PageToken, request.PageToken)
+					}
+					if request.LabelSelector != tc.incoming.LabelSelector {
+						t.Errorf("expected LabelSelector = %s, received = %s", tc.incoming.LabelSelector, request.LabelSelector)
+					}
+					if request.Owner != tc.incoming.Owner {
+						t.Errorf("expected Owner = %s, received = %s", tc.incoming.Owner, request.Owner)
+					}
+					return tc.forcedResult, tc.forcedError
+				},
+			}
+			postgresServer := NewPostgres(postgresService)
+			result, err := postgresServer.ListPostgres(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedError != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedError == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedError, err)
+			} else if err == nil && !proto.Equal(result, tc.expectedResult) {
+				t.Errorf("expected result = %v, got %v", tc.expectedResult, result)
+			}
+		})
+	}
+}
+
+// GIVEN WatchPostgres
+func TestWatchPostgres(t *testing.T) {
+	tcs := []struct {
+		description    string
+		incoming       *pb.WatchPostgresRequest
+		forcedResult   []models.WatchEvent
+		forcedError    error
+		expectedResult []*pb.WatchPostgresResponse
+		expectedError  error
+	}{
+		{
+			description: "WHEN incoming data is set without error THEN every event is sent through the stream",
+			incoming: &pb.WatchPostgresRequest{
+				Id: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+			},
+			forcedResult: []models.WatchEvent{
+				{
+					ID:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Type:      models.EventProvisioning,
+					Object:    "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Message:   "0/1 replicas ready",
+					Timestamp: time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC),
+				},
+				{
+					ID:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Type:      models.EventReady,
+					Object:    "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Message:   "1/1 replicas ready",
+					Timestamp: time.Date(2024, 4, 1, 10, 1, 0, 0, time.UTC),
+				},
+			},
+			forcedError: nil,
+			expectedResult: []*pb.WatchPostgresResponse{
+				{
+					Id:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Type:      pb.PostgresEventType_POSTGRES_EVENT_TYPE_PROVISIONING,
+					Object:    "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Message:   "0/1 replicas ready",
+					Timestamp: timestamppb.New(time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)),
+				},
+				{
+					Id:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Type:      pb.PostgresEventType_POSTGRES_EVENT_TYPE_READY,
+					Object:    "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+					Message:   "1/1 replicas ready",
+					Timestamp: timestamppb.New(time.Date(2024, 4, 1, 10, 1, 0, 0, time.UTC)),
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			description: "WHEN incoming data is set with error THEN current data is processed and error given",
+			incoming: &pb.WatchPostgresRequest{
+				Id: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+			},
+			forcedError:   errors.New("random"),
+			expectedError: errors.New("random"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			postgresService := &mockPostgresService{
+				watch: func(_ context.Context, request models.WatchRequest) (<-chan models.WatchEvent, error) {
+					if request.ID != tc.incoming.Id {
+						t.Errorf("expected ID = %s, received = %s", tc.incoming.Id, request.ID)
+					}
+					if tc.forcedError != nil {
+						return nil, tc.forcedError
+					}
+					events := make(chan models.WatchEvent, len(tc.forcedResult))
+					for _, event := range tc.forcedResult {
+						events <- event
+					}
+					close(events)
+					return events, nil
+				},
+			}
+			stream := &mockWatchStream{ctx: context.Background()}
+			postgresServer := NewPostgres(postgresService)
+			err := postgresServer.WatchPostgres(tc.incoming, stream)
+			if (err != nil) != (tc.expectedError != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedError == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedError, err)
+			} else if len(stream.sent) != len(tc.expectedResult) {
+				t.Errorf("expected %d events, got %d", len(tc.expectedResult), len(stream.sent))
+			} else {
+				for idx := range stream.sent {
+					if !proto.Equal(stream.sent[idx], tc.expectedResult[idx]) {
+						t.Errorf("expected event = %v, got %v", tc.expectedResult[idx], stream.sent[idx])
+					}
+				}
+			}
+		})
+	}
+}
+
 // GIVEN DeletePostgres
 func TestDeletePostgres(t *testing.T) {
 	tcs := []struct {
@@ -122,19 +462,75 @@ func TestDeletePostgres(t *testing.T) {
 	for _, tc := range tcs {
 		t.Run(tc.description, func(t *testing.T) {
 			postgresService := &mockPostgresService{
-				delete: func(_ context.Context, request models.DeleteRequest) error {
+				delete: func(_ context.Context, request models.DeleteRequest) (models.DeleteResponse, error) {
 					if request.ID != tc.incoming.Id {
 						t.Errorf("expected ID = %s, received = %s", tc.incoming.Id, request.ID)
 					}
-					return tc.forcedError
+					return models.DeleteResponse{Objects: []models.DeletedObject{
+						{Kind: "StatefulSet", Name: request.ID, Result: models.DeleteResultDeleted},
+						{Kind: "Service", Name: "postgres-" + request.ID, Result: models.DeleteResultNotFound},
+					}}, tc.forcedError
 				},
 			}
 			postgresServer := NewPostgres(postgresService)
-			_, err := postgresServer.DeletePostgres(context.Background(), tc.incoming)
+			result, err := postgresServer.DeletePostgres(context.Background(), tc.incoming)
 			if (err != nil) != (tc.expectedError != nil) {
 				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedError == nil, err == nil, err)
 			} else if err != nil && err.Error() != tc.expectedError.Error() {
 				t.Errorf("expected error = %v, received error = %v", tc.expectedError, err)
+			} else if len(result.Objects) != 2 || result.Objects[1].Result != pb.PostgresDeleteResult_POSTGRES_DELETE_RESULT_NOT_FOUND {
+				t.Errorf("unexpected deleted objects %v", result.Objects)
+			}
+		})
+	}
+}
+
+// GIVEN GetPostgresDrift
+func TestGetPostgresDrift(t *testing.T) {
+	tcs := []struct {
+		description   string
+		incoming      *pb.GetPostgresDriftRequest
+		forcedError   error
+		expectedError error
+	}{
+		{
+			description: "WHEN incoming data is set without error THEN drifted objects are returned and no error given",
+			incoming: &pb.GetPostgresDriftRequest{
+				Id: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+			},
+			forcedError:   nil,
+			expectedError: nil,
+		},
+		{
+			description: "WHEN incoming data is set with error THEN current data is processed and error given",
+			incoming: &pb.GetPostgresDriftRequest{
+				Id: "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+			},
+			forcedError:   errors.New("random"),
+			expectedError: errors.New("random"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			postgresService := &mockPostgresService{
+				drift: func(_ context.Context, request models.DriftRequest) (models.DriftResponse, error) {
+					if request.ID != tc.incoming.Id {
+						t.Errorf("expected ID = %s, received = %s", tc.incoming.Id, request.ID)
+					}
+					return models.DriftResponse{Objects: []models.DriftedObject{
+						{Kind: "Service", Name: "postgres-" + request.ID, Fields: []string{"spec.selector.app"}},
+						{Kind: "Secret", Name: "postgres-credentials-" + request.ID, Missing: true},
+					}}, tc.forcedError
+				},
+			}
+			postgresServer := NewPostgres(postgresService)
+			result, err := postgresServer.GetPostgresDrift(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedError != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedError == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedError, err)
+			} else if err == nil && (len(result.Objects) != 2 || result.Objects[0].Fields[0] != "spec.selector.app" || !result.Objects[1].Missing) {
+				t.Errorf("unexpected drifted objects %v", result.Objects)
 			}
 		})
 	}
@@ -157,6 +553,28 @@ func TestUpdatePostgres(t *testing.T) {
 			forcedError:   nil,
 			expectedError: nil,
 		},
+		{
+			description: "WHEN incoming data is set with update mask THEN masked data is processed and no error given",
+			incoming: &pb.UpdatePostgresRequest{
+				Id:         "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"port_num", "image_tag", "resources.cpu_limit"}},
+				PortNum:    5433,
+				ImageTag:   "16",
+				Resources:  &pb.PostgresResources{CpuLimit: "2"},
+			},
+			forcedError:   nil,
+			expectedError: nil,
+		},
+		{
+			description: "WHEN incoming image is set with update mask THEN the image reference is processed and no error given",
+			incoming: &pb.UpdatePostgresRequest{
+				Id:         "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"image"}},
+				Image:      "registry.example.com/postgres:16.3",
+			},
+			forcedError:   nil,
+			expectedError: nil,
+		},
 		{
 			description: "WHEN incoming data is set with error THEN current data is processed and error given",
 			incoming: &pb.UpdatePostgresRequest{
@@ -177,6 +595,21 @@ func TestUpdatePostgres(t *testing.T) {
 					if request.Replicas != tc.incoming.Replicas {
 						t.Errorf("expected Replicas = %d, received = %d", tc.incoming.Replicas, request.Replicas)
 					}
+					if diff := cmp.Diff(tc.incoming.GetUpdateMask().GetPaths(), request.UpdateMask); diff != "" {
+						t.Errorf("update mask has diff %s", diff)
+					}
+					if request.PortNum != tc.incoming.PortNum {
+						t.Errorf("expected PortNum = %d, received = %d", tc.incoming.PortNum, request.PortNum)
+					}
+					if request.ImageTag != tc.incoming.ImageTag {
+						t.Errorf("expected ImageTag = %s, received = %s", tc.incoming.ImageTag, request.ImageTag)
+					}
+					if request.Image != tc.incoming.Image {
+						t.Errorf("expected Image = %s, received = %s", tc.incoming.Image, request.Image)
+					}
+					if request.Resources.CPULimit != tc.incoming.GetResources().GetCpuLimit() {
+						t.Errorf("expected CPULimit = %s, received = %s", tc.incoming.GetResources().GetCpuLimit(), request.Resources.CPULimit)
+					}
 					return tc.forcedError
 				},
 			}
@@ -194,18 +627,54 @@ func TestUpdatePostgres(t *testing.T) {
 // Mocked Postgres Service
 type mockPostgresService struct {
 	create func(context.Context, models.CreateRequest) (models.CreateResponse, error)
-	delete func(context.Context, models.DeleteRequest) error
+	get    func(context.Context, models.GetRequest) (models.GetResponse, error)
+	list   func(context.Context, models.ListRequest) (models.ListResponse, error)
+	watch  func(context.Context, models.WatchRequest) (<-chan models.WatchEvent, error)
+	delete func(context.Context, models.DeleteRequest) (models.DeleteResponse, error)
 	update func(context.Context, models.UpdateRequest) error
+	drift  func(context.Context, models.DriftRequest) (models.DriftResponse, error)
 }
 
 func (m *mockPostgresService) Create(ctx context.Context, request models.CreateRequest) (models.CreateResponse, error) {
 	return m.create(ctx, request)
 }
 
-func (m *mockPostgresService) Delete(ctx context.Context, request models.DeleteRequest) error {
+func (m *mockPostgresService) Get(ctx context.Context, request models.GetRequest) (models.GetResponse, error) {
+	return m.get(ctx, request)
+}
+
+func (m *mockPostgresService) List(ctx context.Context, request models.ListRequest) (models.ListResponse, error) {
+	return m.list(ctx, request)
+}
+
+func (m *mockPostgresService) Watch(ctx context.Context, request models.WatchRequest) (<-chan models.WatchEvent, error) {
+	return m.watch(ctx, request)
+}
+
+func (m *mockPostgresService) Delete(ctx context.Context, request models.DeleteRequest) (models.DeleteResponse, error) {
 	return m.delete(ctx, request)
 }
 
 func (m *mockPostgresService) Update(ctx context.Context, request models.UpdateRequest) error {
 	return m.update(ctx, request)
 }
+
+func (m *mockPostgresService) Drift(ctx context.Context, request models.DriftRequest) (models.DriftResponse, error) {
+	return m.drift(ctx, request)
+}
+
+// Mocked WatchPostgres stream
+type mockWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*pb.WatchPostgresResponse
+}
+
+func (m *mockWatchStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockWatchStream) Send(response *pb.WatchPostgresResponse) error {
+	m.sent = append(m.sent, response)
+	return nil
+}
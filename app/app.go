@@ -12,6 +12,7 @@ import (
 	"schwarz/api/middlewares"
 	pb "schwarz/api/proto"
 	"schwarz/api/servers"
+	"schwarz/models"
 	kubernetesService "schwarz/services/kubernetes"
 	prometheusService "schwarz/services/prometheus"
 	"syscall"
@@ -23,10 +24,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// Instances reconciled at once in controller mode
+const controllerWorkers = 2
+
 func Start() {
 	// Get config params
 	cfg, err := NewConfig()
@@ -59,14 +64,85 @@ func Start() {
 	}
 	registry.MustRegister(customMetrics)
 
+	// Server Context
+	sCtx := serverContext(context.Background())
+
+	// Informer cache serving the reads, readiness waits for its sync
+	cache := kubernetesService.NewCache(kubeClient, customMetrics)
+	go func() {
+		if err := cache.Run(sCtx); err != nil {
+			log.Printf("informer cache stopped: %v", err)
+		}
+	}()
+
 	// Postgres Service Init
-	postgresService := kubernetesService.NewPostgres(kubeClient, customMetrics)
+	postgresConfig := kubernetesService.PostgresConfig{
+		HostPathStorage:  cfg.HostPathStorage,
+		DefaultNamespace: cfg.DefaultNamespace,
+		TenantNamespaces: cfg.TenantNamespaces,
+		DefaultResources: models.Resources{
+			CPURequest:    cfg.DefaultCPURequest,
+			CPULimit:      cfg.DefaultCPULimit,
+			MemoryRequest: cfg.DefaultMemoryRequest,
+			MemoryLimit:   cfg.DefaultMemoryLimit,
+		},
+		MinPodSecurityLevel: cfg.MinPodSecurityLevel,
+		Cache:               cache,
+		DefaultImage:        cfg.DefaultPostgresImage,
+	}
+	postgresService := kubernetesService.NewPostgres(kubeClient, customMetrics, postgresConfig)
 
-	// Validator Service Init
-	validatorService := kubernetesService.NewValidator(postgresService)
+	// Controller mode, requests write PostgresInstance objects reconciled by the controller
+	var dynamicClient dynamic.Interface
+	if cfg.ControllerMode {
+		dynamicClient, err = dynamic.NewForConfig(kubeConfig)
+		if err != nil {
+			log.Fatalf("failed to load kubeConfig: %v", err)
+		}
+		postgresService = kubernetesService.NewInstances(kubeClient, dynamicClient, customMetrics, postgresConfig)
+	}
 
-	// Server Context
-	sCtx := serverContext(context.Background())
+	// Background loops, run until the context is done or, with leader election, the leadership is lost
+	background := func(ctx context.Context) {
+		// Relabel instances created before per-instance label selectors
+		if err := kubernetesService.MigrateLabels(ctx, kubeClient); err != nil {
+			log.Printf("failed to migrate instance labels: %v", err)
+		}
+		// Drift detection, repaired unless disabled per instance when DRIFT_REPAIR is set
+		if cfg.DriftInterval > 0 {
+			driftDetector := kubernetesService.NewDriftDetector(kubeClient, customMetrics, postgresConfig, cfg.DriftRepair)
+			go driftDetector.Run(ctx, cfg.DriftInterval)
+		}
+		if cfg.ControllerMode {
+			controller := kubernetesService.NewController(kubeClient, dynamicClient, customMetrics, postgresConfig, cfg.PostgresImages)
+			if err := controller.Run(ctx, controllerWorkers); err != nil {
+				log.Printf("instance controller stopped: %v", err)
+			}
+		}
+	}
+
+	// Leader election, the requests are served by every replica but the background loops only by the leader
+	var leader *kubernetesService.Leader
+	if cfg.LeaderElection {
+		identity, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("failed to get leader election identity: %v", err)
+		}
+		leaseNamespace := cfg.LeaseNamespace
+		if leaseNamespace == "" {
+			leaseNamespace = cfg.DefaultNamespace
+		}
+		leader, err = kubernetesService.NewLeader(kubeClient, customMetrics, leaseNamespace, identity, background)
+		if err != nil {
+			log.Fatalf("failed to create leader election: %v", err)
+		}
+		go leader.Run(sCtx)
+	} else {
+		go background(sCtx)
+	}
+
+	// Validator Service Init
+	validatorService := kubernetesService.NewValidator(postgresService, cfg.PostgresImages, postgresConfig.DefaultResources)
 
 	// Handlers
 	metricsHandler := handlers.NewMetrics(registry)
@@ -78,8 +154,13 @@ func Start() {
 			_, readyzErr = kubeClient.RESTClient().Get().AbsPath("/readyz").DoRaw(context.Background())
 			return readyzErr
 		})
+	health.AddReadinessCheck("cache", cache.Ready)
+	var readiness healthcheck.Handler = health
+	if leader != nil {
+		readiness = handlers.NewReadiness(health, leader.Details)
+	}
 	// HTTP Server Init
-	httpServer := servers.NewHealthcheck("", cfg.HealthPort, cfg.HttpTimeout, metricsHandler, health)
+	httpServer := servers.NewHealthcheck("", cfg.HealthPort, cfg.HttpTimeout, metricsHandler, readiness)
 	httpServer.Run()
 
 	// server-side TLS
@@ -105,6 +186,7 @@ func Start() {
 			grpcRecovery.UnaryServerInterceptor(),
 		),
 		grpc.ChainStreamInterceptor(
+			middlewares.AuthStreamInterceptor,
 			serverMetrics.StreamServerInterceptor(),
 			grpcRecovery.StreamServerInterceptor(),
 		),
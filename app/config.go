@@ -3,22 +3,78 @@ package app
 import (
 	"fmt"
 	"os"
+	kubernetesService "schwarz/services/kubernetes"
+	"strconv"
+	"strings"
 	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
 	envHTTPPort    = "HTTP_PORT"
 	envGRCPPort    = "GRPC_PORT"
 	envHttpTimeout = "HTTP_TIMEOUT"
+	// Optional, hostPath volumes for instances without storage class, only meant for development clusters
+	envHostPathStorage = "HOSTPATH_STORAGE"
+	// Optional, namespace of the requests without one
+	envDefaultNamespace = "DEFAULT_NAMESPACE"
+	// Optional, instances of each owner go to their own namespace with a ResourceQuota and LimitRange
+	envTenantNamespaces = "TENANT_NAMESPACES"
+	// Optional, resources of the pods of instances created or updated without them
+	envDefaultCPURequest    = "DEFAULT_CPU_REQUEST"
+	envDefaultCPULimit      = "DEFAULT_CPU_LIMIT"
+	envDefaultMemoryRequest = "DEFAULT_MEMORY_REQUEST"
+	envDefaultMemoryLimit   = "DEFAULT_MEMORY_LIMIT"
+	// Optional, minimum Pod Security level (privileged, baseline or restricted) namespaces must enforce to get instances
+	envMinPodSecurityLevel = "MIN_POD_SECURITY_LEVEL"
+	// Optional, requests write PostgresInstance objects whose objects are created by the controller
+	envControllerMode = "CONTROLLER_MODE"
+	// Optional, how often the objects of every instance are compared with the generated ones, never when unset
+	envDriftInterval = "DRIFT_INTERVAL"
+	// Optional, drifted objects are applied again unless the instance opted out
+	envDriftRepair = "DRIFT_REPAIR"
+	// Optional, replicas campaign for a Lease and only the leader runs the background loops
+	envLeaderElection = "LEADER_ELECTION"
+	// Optional, namespace of the Lease, the default namespace when unset
+	envLeaseNamespace = "LEADER_ELECTION_NAMESPACE"
+	// Optional, comma separated images, or versions of the official postgres image, instances may run. Any when unset
+	envPostgresImages = "POSTGRES_IMAGES"
+	// Optional, image or version of the official postgres image of instances created without one
+	envDefaultPostgresImage = "DEFAULT_POSTGRES_IMAGE"
+
+	defaultNamespaceValue     = "default"
+	defaultCPURequestValue    = "250m"
+	defaultCPULimitValue      = "1"
+	defaultMemoryRequestValue = "256Mi"
+	defaultMemoryLimitValue   = "1Gi"
+	defaultPostgresImageValue = "postgres:14"
 
 	envNotSet   = " env not set"
 	envNonValid = "end non valid"
 )
 
 type Config struct {
-	HealthPort  string
-	GRPCPort    string
-	HttpTimeout time.Duration
+	HealthPort       string
+	GRPCPort         string
+	HttpTimeout      time.Duration
+	HostPathStorage  bool
+	DefaultNamespace string
+	TenantNamespaces bool
+	// Empty values leave the resource unset
+	DefaultCPURequest    string
+	DefaultCPULimit      string
+	DefaultMemoryRequest string
+	DefaultMemoryLimit   string
+	MinPodSecurityLevel  string
+	ControllerMode       bool
+	DriftInterval        time.Duration
+	DriftRepair          bool
+	LeaderElection       bool
+	// Empty for the default namespace
+	LeaseNamespace       string
+	PostgresImages       []string
+	DefaultPostgresImage string
 }
 
 func NewConfig() (*Config, error) {
@@ -40,9 +96,120 @@ func NewConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf(envHttpTimeout + envNonValid)
 	}
+	var hostPathStorage bool
+	if hostPathStorageRaw, set := os.LookupEnv(envHostPathStorage); set {
+		hostPathStorage, err = strconv.ParseBool(hostPathStorageRaw)
+		if err != nil {
+			return nil, fmt.Errorf(envHostPathStorage + envNonValid)
+		}
+	}
+	defaultNamespace, set := os.LookupEnv(envDefaultNamespace)
+	if !set {
+		defaultNamespace = defaultNamespaceValue
+	}
+	var tenantNamespaces bool
+	if tenantNamespacesRaw, set := os.LookupEnv(envTenantNamespaces); set {
+		tenantNamespaces, err = strconv.ParseBool(tenantNamespacesRaw)
+		if err != nil {
+			return nil, fmt.Errorf(envTenantNamespaces + envNonValid)
+		}
+	}
+	defaultCPURequest, err := lookupQuantity(envDefaultCPURequest, defaultCPURequestValue)
+	if err != nil {
+		return nil, err
+	}
+	defaultCPULimit, err := lookupQuantity(envDefaultCPULimit, defaultCPULimitValue)
+	if err != nil {
+		return nil, err
+	}
+	defaultMemoryRequest, err := lookupQuantity(envDefaultMemoryRequest, defaultMemoryRequestValue)
+	if err != nil {
+		return nil, err
+	}
+	defaultMemoryLimit, err := lookupQuantity(envDefaultMemoryLimit, defaultMemoryLimitValue)
+	if err != nil {
+		return nil, err
+	}
+	minPodSecurityLevel := os.Getenv(envMinPodSecurityLevel)
+	switch minPodSecurityLevel {
+	case "", "privileged", "baseline", "restricted":
+	default:
+		return nil, fmt.Errorf(envMinPodSecurityLevel + envNonValid)
+	}
+	var controllerMode bool
+	if controllerModeRaw, set := os.LookupEnv(envControllerMode); set {
+		controllerMode, err = strconv.ParseBool(controllerModeRaw)
+		if err != nil {
+			return nil, fmt.Errorf(envControllerMode + envNonValid)
+		}
+	}
+	var driftInterval time.Duration
+	if driftIntervalRaw, set := os.LookupEnv(envDriftInterval); set {
+		driftInterval, err = time.ParseDuration(driftIntervalRaw)
+		if err != nil || driftInterval < 0 {
+			return nil, fmt.Errorf(envDriftInterval + envNonValid)
+		}
+	}
+	var driftRepair bool
+	if driftRepairRaw, set := os.LookupEnv(envDriftRepair); set {
+		driftRepair, err = strconv.ParseBool(driftRepairRaw)
+		if err != nil {
+			return nil, fmt.Errorf(envDriftRepair + envNonValid)
+		}
+	}
+	var leaderElection bool
+	if leaderElectionRaw, set := os.LookupEnv(envLeaderElection); set {
+		leaderElection, err = strconv.ParseBool(leaderElectionRaw)
+		if err != nil {
+			return nil, fmt.Errorf(envLeaderElection + envNonValid)
+		}
+	}
+	var postgresImages []string
+	for _, image := range strings.Split(os.Getenv(envPostgresImages), ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			postgresImages = append(postgresImages, image)
+		}
+	}
+	defaultPostgresImage, set := os.LookupEnv(envDefaultPostgresImage)
+	if !set {
+		defaultPostgresImage = defaultPostgresImageValue
+	}
+	if !kubernetesService.ImageAllowed(defaultPostgresImage, postgresImages) {
+		return nil, fmt.Errorf(envDefaultPostgresImage + envNonValid)
+	}
 	return &Config{
-		GRPCPort:    grpcPort,
-		HealthPort:  healthPort,
-		HttpTimeout: httpTimeout,
+		GRPCPort:             grpcPort,
+		HealthPort:           healthPort,
+		HttpTimeout:          httpTimeout,
+		HostPathStorage:      hostPathStorage,
+		DefaultNamespace:     defaultNamespace,
+		TenantNamespaces:     tenantNamespaces,
+		DefaultCPURequest:    defaultCPURequest,
+		DefaultCPULimit:      defaultCPULimit,
+		DefaultMemoryRequest: defaultMemoryRequest,
+		DefaultMemoryLimit:   defaultMemoryLimit,
+		MinPodSecurityLevel:  minPodSecurityLevel,
+		ControllerMode:       controllerMode,
+		DriftInterval:        driftInterval,
+		DriftRepair:          driftRepair,
+		LeaderElection:       leaderElection,
+		LeaseNamespace:       os.Getenv(envLeaseNamespace),
+		PostgresImages:       postgresImages,
+		DefaultPostgresImage: defaultPostgresImage,
 	}, nil
 }
+
+// lookupQuantity reads an optional resource quantity, set empty to leave the resource unset
+func lookupQuantity(env, defaultValue string) (string, error) {
+	value, set := os.LookupEnv(env)
+	if !set {
+		return defaultValue, nil
+	}
+	if value == "" {
+		return "", nil
+	}
+	if _, err := resource.ParseQuantity(value); err != nil {
+		return "", fmt.Errorf(env + envNonValid)
+	}
+	return value, nil
+}
@@ -36,13 +36,179 @@ func TestNewConfig(t *testing.T) {
 			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "s45"},
 			expectedErr: fmt.Errorf(envHttpTimeout + envNonValid),
 		},
+		{
+			description: "WHEN HOSTPATH_STORAGE environmental variable is not a boolean THEN envHostPathStorage envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "HOSTPATH_STORAGE": "dev"},
+			expectedErr: fmt.Errorf(envHostPathStorage + envNonValid),
+		},
+		{
+			description: "WHEN HOSTPATH_STORAGE environmental variable is set THEN hostPath storage is enabled",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "HOSTPATH_STORAGE": "true"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				HostPathStorage:      true,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "postgres:14",
+			},
+			expectedErr: nil,
+		},
 		{
 			description: "WHEN all environmental variables are set THEN no error",
 			incoming:    map[string]string{"HTTP_PORT": "8602", "GRPC_PORT": "50052", "HTTP_TIMEOUT": "45s"},
 			expected: &Config{
-				HealthPort:  "8602",
-				GRPCPort:    "50052",
-				HttpTimeout: time.Second * 45,
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "postgres:14",
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN TENANT_NAMESPACES environmental variable is not a boolean THEN envTenantNamespaces envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "TENANT_NAMESPACES": "owner"},
+			expectedErr: fmt.Errorf(envTenantNamespaces + envNonValid),
+		},
+		{
+			description: "WHEN namespace environmental variables are set THEN namespaces are configured",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "DEFAULT_NAMESPACE": "databases", "TENANT_NAMESPACES": "true"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "databases",
+				TenantNamespaces:     true,
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "postgres:14",
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN DEFAULT_MEMORY_LIMIT environmental variable is not a quantity THEN envDefaultMemoryLimit envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "DEFAULT_MEMORY_LIMIT": "1 GB"},
+			expectedErr: fmt.Errorf(envDefaultMemoryLimit + envNonValid),
+		},
+		{
+			description: "WHEN MIN_POD_SECURITY_LEVEL environmental variable is not a Pod Security level THEN envMinPodSecurityLevel envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "MIN_POD_SECURITY_LEVEL": "strict"},
+			expectedErr: fmt.Errorf(envMinPodSecurityLevel + envNonValid),
+		},
+		{
+			description: "WHEN CONTROLLER_MODE environmental variable is not a boolean THEN envControllerMode envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "CONTROLLER_MODE": "on"},
+			expectedErr: fmt.Errorf(envControllerMode + envNonValid),
+		},
+		{
+			description: "WHEN CONTROLLER_MODE environmental variable is set THEN controller mode is enabled",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "CONTROLLER_MODE": "true"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "postgres:14",
+				ControllerMode:       true,
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN DRIFT_INTERVAL environmental variable has no valid format THEN envDriftInterval envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "DRIFT_INTERVAL": "5"},
+			expectedErr: fmt.Errorf(envDriftInterval + envNonValid),
+		},
+		{
+			description: "WHEN drift environmental variables are set THEN drift detection is configured",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "DRIFT_INTERVAL": "5m", "DRIFT_REPAIR": "true"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "postgres:14",
+				DriftInterval:        5 * time.Minute,
+				DriftRepair:          true,
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN LEADER_ELECTION environmental variable is not a boolean THEN envLeaderElection envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "LEADER_ELECTION": "lease"},
+			expectedErr: fmt.Errorf(envLeaderElection + envNonValid),
+		},
+		{
+			description: "WHEN leader election environmental variables are set THEN leader election is configured",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "LEADER_ELECTION": "true", "LEADER_ELECTION_NAMESPACE": "schwarz"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "postgres:14",
+				LeaderElection:       true,
+				LeaseNamespace:       "schwarz",
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN DEFAULT_POSTGRES_IMAGE environmental variable is not in the allowlist THEN envDefaultPostgresImage envNonValid error",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "POSTGRES_IMAGES": "15,16"},
+			expectedErr: fmt.Errorf(envDefaultPostgresImage + envNonValid),
+		},
+		{
+			description: "WHEN image environmental variables are set THEN the allowlist and default image are configured",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "POSTGRES_IMAGES": "15, postgres:16,", "DEFAULT_POSTGRES_IMAGE": "16"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "250m",
+				DefaultCPULimit:      "1",
+				DefaultMemoryRequest: "256Mi",
+				DefaultMemoryLimit:   "1Gi",
+				DefaultPostgresImage: "16",
+				PostgresImages:       []string{"15", "postgres:16"},
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN resource environmental variables are set THEN default resources are overridden",
+			incoming:    map[string]string{"GRPC_PORT": "50052", "HTTP_PORT": "8602", "HTTP_TIMEOUT": "45s", "DEFAULT_CPU_REQUEST": "500m", "DEFAULT_CPU_LIMIT": "", "DEFAULT_MEMORY_REQUEST": "512Mi", "DEFAULT_MEMORY_LIMIT": "2Gi", "MIN_POD_SECURITY_LEVEL": "baseline"},
+			expected: &Config{
+				HealthPort:           "8602",
+				GRPCPort:             "50052",
+				HttpTimeout:          time.Second * 45,
+				DefaultNamespace:     "default",
+				DefaultCPURequest:    "500m",
+				DefaultMemoryRequest: "512Mi",
+				DefaultMemoryLimit:   "2Gi",
+				DefaultPostgresImage: "postgres:14",
+				MinPodSecurityLevel:  "baseline",
 			},
 			expectedErr: nil,
 		},
@@ -1,26 +1,239 @@
 package models
 
+import "time"
+
 // https://www.digitalocean.com/community/tutorials/how-to-deploy-postgres-to-kubernetes-cluster
 
 type CreateRequest struct {
-	DBName     string
-	UserName   string
-	UserPass   string
-	PortNum    int32  // Number of port to expose on the pod's IP address
-	Replicas   int32  // Number of desired pods.
-	Capacity   string // https://kubernetes.io/docs/concepts/storage/persistent-volumes#resources
-	AccessMode string // https://kubernetes.io/docs/concepts/storage/persistent-volumes#binding
+	DBName              string
+	UserName            string
+	UserPass            string
+	PortNum             int32             // Number of port to expose on the pod's IP address
+	Replicas            int32             // Number of desired pods, a primary and Replicas-1 hot standbys.
+	Capacity            string            // https://kubernetes.io/docs/concepts/storage/persistent-volumes#resources
+	AccessMode          string            // https://kubernetes.io/docs/concepts/storage/persistent-volumes#binding
+	Owner               string            // Optional owner stamped as label, used to filter instances on List
+	RequestID           string            // Optional idempotency key, replaying it returns the instance already created
+	Workload            string            // statefulset (default) gives each replica its own volume, deployment shares one
+	StorageClass        string            // https://kubernetes.io/docs/concepts/storage/storage-classes, cluster default when empty
+	Namespace           string            // Service default, or the owner namespace in tenant mode, when empty
+	Exposure            string            // clusterip (default), nodeport, loadbalancer or headless
+	ExposureAnnotations map[string]string // Annotations of the LoadBalancer Service, read by the cloud provider
+	Resources           Resources         // Quantities left empty take the service defaults
+	Probes              Probes            // Settings left zero take the defaults
+	AllowedClients      AllowedClients    // Clients of the instance namespace when empty
+	Scheduling          Scheduling
+	Image               string // Version of the official postgres image, like 16, or image reference. Service default when empty
+}
+
+// Scheduling places the pods of an instance, https://kubernetes.io/docs/concepts/scheduling-eviction/assign-pod-node
+type Scheduling struct {
+	NodeSelector   map[string]string
+	Tolerations    []Toleration
+	AntiAffinity   AntiAffinity // Keeps the replicas apart
+	TopologySpread []TopologySpread
+}
+
+type Toleration struct {
+	Key      string
+	Operator string // Equal (default) or Exists
+	Value    string
+	Effect   string // NoSchedule, PreferNoSchedule or NoExecute, every effect when empty
+}
+
+type AntiAffinity struct {
+	Topology string // node or zone, no anti-affinity when empty
+	Required bool   // Replicas which can't be kept apart stay pending, instead of sharing a node or zone
+}
+
+type TopologySpread struct {
+	Topology          string // node or zone
+	MaxSkew           int32  // Maximum difference of replicas between any two nodes or zones
+	WhenUnsatisfiable string // ScheduleAnyway (default) or DoNotSchedule
+}
+
+// AllowedClients are the sources allowed to connect to the postgres port, any of them matching is enough.
+// Clients reaching a NodePort or LoadBalancer come from node or external addresses, allowed through CIDRs.
+type AllowedClients struct {
+	NamespaceSelectors []string // https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#label-selectors, every pod of the namespaces
+	PodSelectors       []string // Pods of the instance namespace
+	CIDRs              []string
+}
+
+// Resources are the compute resources of each pod, https://kubernetes.io/docs/concepts/configuration/manage-resources-containers
+// Probes tune the pg_isready startup, readiness and liveness probes of each pod
+type Probes struct {
+	PeriodSeconds         int32 // How often pg_isready is run
+	TimeoutSeconds        int32 // How long pg_isready may take
+	FailureThreshold      int32 // Consecutive failures before the pod is unready, or restarted
+	StartupTimeoutSeconds int32 // How long initdb or the base backup may take before the pod is restarted
+}
+
+type Resources struct {
+	CPURequest    string
+	CPULimit      string
+	MemoryRequest string
+	MemoryLimit   string
 }
 
 type CreateResponse struct {
-	ID string
+	ID        string
+	Namespace string // Namespace the instance was created in
+	Endpoint  Endpoint
+}
+
+type Endpoint struct {
+	Exposure        string
+	DNSName         string // Cluster DNS name of the Service
+	Port            int32
+	NodePort        int32  // Port exposed on each node by NodePort and LoadBalancer Services
+	ExternalAddress string // IP or hostname of the LoadBalancer, empty until assigned
+}
+
+type GetRequest struct {
+	ID        string
+	Namespace string
+}
+
+type GetResponse struct {
+	ID                string
+	Namespace         string
+	DBName            string
+	PortNum           int32  // Number of port exposed on the pod's IP address
+	Replicas          int32  // Number of desired pods.
+	Capacity          string // https://kubernetes.io/docs/concepts/storage/persistent-volumes#resources
+	AccessMode        string // https://kubernetes.io/docs/concepts/storage/persistent-volumes#binding
+	ReadyReplicas     int32  // Number of pods with a Ready condition.
+	AvailableReplicas int32  // Number of pods available for at least minReadySeconds.
+	NodePort          int32  // Port exposed on each node by the NodePort Service
+	Workload          string // Kind of the workload running the instance, statefulset or deployment
+	ReadOnlyNodePort  int32  // Port exposed on each node by the read-only Service of a StatefulSet
+	StorageClass      string
+	Image             string // Image run by the postgres container
+	Endpoint          Endpoint
+	ReadOnlyEndpoint  Endpoint // Only set for StatefulSets
+	Resources         Resources
+	Probes            Probes
+	Pods              []PodStatus
+	CreatedAt         time.Time
+}
+
+type PodRole string
+
+const (
+	RolePrimary    PodRole = "Primary"    // Accepts writes, streams its WAL to the replicas
+	RoleReplica    PodRole = "Replica"    // Hot standby replaying the WAL of the primary
+	RoleStandalone PodRole = "Standalone" // Pod of a Deployment, not replicating
+)
+
+type PodStatus struct {
+	Name  string
+	Role  PodRole
+	Ready bool
+}
+
+type ListRequest struct {
+	PageSize      int64  // Maximum number of instances returned, zero means server default
+	PageToken     string // Opaque token returned by the previous page
+	LabelSelector string // https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#label-selectors
+	Owner         string
+	Namespace     string
+}
+
+type ListResponse struct {
+	Instances     []InstanceSummary
+	NextPageToken string // Empty when there are no more pages
+}
+
+type InstanceSummary struct {
+	ID                string
+	Namespace         string
+	Owner             string
+	PortNum           int32
+	Replicas          int32
+	ReadyReplicas     int32
+	AvailableReplicas int32
+	Workload          string
+	CreatedAt         time.Time
+}
+
+type WatchRequest struct {
+	ID        string
+	Namespace string
+}
+
+type EventType string
+
+const (
+	EventProvisioning EventType = "Provisioning" // Workload created but not all replicas are ready yet
+	EventPVCBound     EventType = "PVCBound"     // PersistentVolumeClaim bound to a volume
+	EventPodScheduled EventType = "PodScheduled" // Pod assigned to a node
+	EventReady        EventType = "Ready"        // All desired replicas are ready
+	EventDegraded     EventType = "Degraded"     // Ready replicas dropped below the desired number
+	EventDeleting     EventType = "Deleting"     // Workload marked for deletion
+	EventDeleted      EventType = "Deleted"      // Workload removed, no more events will follow
+)
+
+type WatchEvent struct {
+	ID        string
+	Type      EventType
+	Object    string // Name of the Kubernetes object which produced the event
+	Message   string
+	Timestamp time.Time
 }
 
 type DeleteRequest struct {
-	ID string
+	ID        string
+	Namespace string
+}
+
+type DeleteResponse struct {
+	Objects []DeletedObject // Result of each object of the instance, failed ones are left for a retry
+}
+
+type DeleteResult string
+
+const (
+	DeleteResultDeleted  DeleteResult = "Deleted"
+	DeleteResultNotFound DeleteResult = "NotFound" // Already deleted, by a previous delete or the garbage collector
+	DeleteResultFailed   DeleteResult = "Failed"
+)
+
+type DeletedObject struct {
+	Kind   string
+	Name   string
+	Result DeleteResult
+	Error  string // Only set for failed objects
+}
+
+type DriftRequest struct {
+	ID        string
+	Namespace string
+}
+
+type DriftResponse struct {
+	Objects []DriftedObject // Only the objects which drifted
+}
+
+type DriftedObject struct {
+	Kind    string
+	Name    string
+	Missing bool     // Deleted since it was created
+	Fields  []string // Paths of the fields differing from the generated object, like spec.selector.app
+	// Paths of the generated fields the object predates, kept as they are since applying them needs a migration
+	LegacyFields []string
 }
 
 type UpdateRequest struct {
-	ID       string
-	Replicas int32 // Number of desired pods.
+	ID         string
+	Namespace  string
+	UpdateMask []string // Fields to update, only Replicas is updated when empty
+	Replicas   int32    // Number of desired pods.
+	PortNum    int32
+	UserName   string
+	UserPass   string
+	Capacity   string    // Only expansion is supported
+	ImageTag   string    // Tag of the running image, which keeps its repository
+	Image      string    // Image reference, or version of the official image, replacing the running one
+	Resources  Resources // Quantities left empty take the service defaults
 }
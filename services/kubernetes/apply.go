@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// fieldManager owns the fields of the generated objects. Fields set by anyone else are left alone.
+const fieldManager = "schwarz"
+
+// applyOptions take over the fields we manage from whoever changed them since
+var applyOptions = metav1.ApplyOptions{FieldManager: fieldManager, Force: true}
+
+// legacyFieldManager owned the fields set by the plain creates and updates of earlier versions. The
+// apiserver names the manager of requests without one after the client user agent.
+var legacyFieldManager = strings.Split(rest.DefaultKubernetesUserAgent(), "/")[0]
+
+// apply creates or updates an object with server-side apply, so it can be run again. The generated
+// object is converted to the apply configuration of its kind, both share the JSON field names.
+func apply[C, T any](ctx context.Context, applyFunc func(context.Context, *C, metav1.ApplyOptions) (T, error), object runtime.Object) error {
+	config, err := applyConfiguration[C](object)
+	if err != nil {
+		return err
+	}
+	_, err = applyFunc(ctx, config, applyOptions)
+	return err
+}
+
+// applyConfiguration converts a generated object or a part of it, the status is dropped since it is
+// never applied
+func applyConfiguration[C any](object any) (*C, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "status")
+	if data, err = json.Marshal(fields); err != nil {
+		return nil, err
+	}
+	config := new(C)
+	return config, json.Unmarshal(data, config)
+}
+
+// managedClient is implemented by the typed clients of the objects updated with server-side apply
+type managedClient[T any] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error)
+}
+
+// getManaged reads an object through the cache before extracting the fields we manage. The fields of
+// objects created by earlier versions are first moved to the field manager, so the following apply can
+// change them. The patch checks the resource version, so those objects are read from the apiserver.
+func getManaged[T runtime.Object](ctx context.Context, client managedClient[T], cached func(string) (T, error), name string) (T, error) {
+	result, err := readThrough(ctx, cached, client.Get, name)
+	if err != nil {
+		return result, err
+	}
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(result, sets.New(legacyFieldManager), fieldManager)
+	if err != nil || patch == nil {
+		return result, err
+	}
+	if cached != nil {
+		return getManaged(ctx, client, nil, name)
+	}
+	return client.Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{})
+}
+
+// applyContainer returns the apply configuration of the named container, added when not managed yet.
+// The pointer is only valid until the next container is added.
+func applyContainer(containers *[]corev1ac.ContainerApplyConfiguration, name string) *corev1ac.ContainerApplyConfiguration {
+	for idx := range *containers {
+		if container := &(*containers)[idx]; container.Name != nil && *container.Name == name {
+			return container
+		}
+	}
+	*containers = append(*containers, *corev1ac.Container().WithName(name))
+	return &(*containers)[len(*containers)-1]
+}
+
+// applyEnvValue sets the value of a container environment variable, replacing the managed one
+func applyEnvValue(container *corev1ac.ContainerApplyConfiguration, name, value string) {
+	for idx := range container.Env {
+		if env := &container.Env[idx]; env.Name != nil && *env.Name == name {
+			env.WithValue(value)
+			return
+		}
+	}
+	container.WithEnv(corev1ac.EnvVar().WithName(name).WithValue(value))
+}
+
+// hasEnv checks whether a container sets the environment variable
+func hasEnv(container apiv1.Container, name string) bool {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return true
+		}
+	}
+	return false
+}
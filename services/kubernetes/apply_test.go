@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"context"
+	"schwarz/models"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeClientset returns a fake clientset creating the objects applied for the first time. The fake
+// only handles apply patches of existing objects, as strategic merges without field ownership.
+func newFakeClientset(objects ...runtime.Object) *fake.Clientset {
+	kubeClient := fake.NewSimpleClientset(objects...)
+	kubeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		if _, err := kubeClient.Tracker().Get(action.GetResource(), action.GetNamespace(), patch.GetName()); !apierrors.IsNotFound(err) {
+			return false, nil, nil
+		}
+		object, _, err := scheme.Codecs.UniversalDeserializer().Decode(patch.GetPatch(), nil, nil)
+		if err != nil {
+			return true, nil, err
+		}
+		return true, object, kubeClient.Tracker().Create(action.GetResource(), object, action.GetNamespace())
+	})
+	return kubeClient
+}
+
+// GIVEN Postgres objects changed by other tools
+func TestPostgresServerSideApply(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	request := models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Workload: workloadDeployment, RequestID: "retry-key"}
+	response, err := postgres.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// Another tool labels the Deployment and annotates its pods
+	deployment, _ := kubeClient.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	deployment.Labels["team"] = "payments"
+	deployment.Spec.Template.Annotations = map[string]string{"backup/enabled": "true"}
+	if _, err := kubeClient.AppsV1().Deployments(metav1.NamespaceDefault).Update(context.Background(), deployment, metav1.UpdateOptions{FieldManager: "kubectl-edit"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	secret, _ := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{})
+
+	// WHEN the request is sent again THEN the existing instance is returned without error
+	if _, err := postgres.Create(context.Background(), request); err != nil {
+		t.Fatalf("expected replayed create to succeed, got error %v", err)
+	}
+	replayed, _ := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{})
+	if string(replayed.Data[envPostgresReplicationPassword]) != string(secret.Data[envPostgresReplicationPassword]) {
+		t.Errorf("expected the replication password to be kept")
+	}
+
+	// WHEN the instance is updated THEN the fields set by the other tool are kept
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathReplicas, updatePathImageTag}, Replicas: 2, ImageTag: "16"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	deployment, _ = kubeClient.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected replicas = 2, got %d", *deployment.Spec.Replicas)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != postgresImageName+":16" {
+		t.Errorf("expected image = %s:16, got %s", postgresImageName, image)
+	}
+	if !hasEnv(deployment.Spec.Template.Spec.Containers[0], envPostgresUser) {
+		t.Errorf("expected the managed env to be applied again, got env %v", deployment.Spec.Template.Spec.Containers[0].Env)
+	}
+	if deployment.Labels["team"] != "payments" {
+		t.Errorf("expected label team to be kept, got labels %v", deployment.Labels)
+	}
+	if deployment.Spec.Template.Annotations["backup/enabled"] != "true" {
+		t.Errorf("expected pod annotation to be kept, got annotations %v", deployment.Spec.Template.Annotations)
+	}
+}
@@ -0,0 +1,240 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"schwarz/services/prometheus"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	cacheResync         = 10 * time.Minute
+	cacheStalenessCheck = 15 * time.Second
+
+	cacheNotSyncedError = "informer caches not synced yet"
+)
+
+// Cache serves the reads of the instances from shared informers watching the objects we manage. It
+// is only used once synced, objects missing from it are read from the apiserver since the writes of
+// this replica may not have reached it yet.
+type Cache struct {
+	factory      informers.SharedInformerFactory
+	metrics      *prometheus.Prometheus
+	statefulSets appslisters.StatefulSetLister
+	deployments  appslisters.DeploymentLister
+	services     corelisters.ServiceLister
+	configMaps   corelisters.ConfigMapLister
+	secrets      corelisters.SecretLister
+	claims       corelisters.PersistentVolumeClaimLister
+	pods         corelisters.PodLister
+	informers    map[string]cache.SharedIndexInformer // By resource, for the staleness metric
+	synced       atomic.Bool
+}
+
+func NewCache(clientset kubernetes.Interface, metrics *prometheus.Prometheus) *Cache {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, cacheResync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = labelManagedBy + "=" + labelManagedByValue
+	}))
+	apps, core := factory.Apps().V1(), factory.Core().V1()
+	return &Cache{
+		factory:      factory,
+		metrics:      metrics,
+		statefulSets: apps.StatefulSets().Lister(),
+		deployments:  apps.Deployments().Lister(),
+		services:     core.Services().Lister(),
+		configMaps:   core.ConfigMaps().Lister(),
+		secrets:      core.Secrets().Lister(),
+		claims:       core.PersistentVolumeClaims().Lister(),
+		pods:         core.Pods().Lister(),
+		informers: map[string]cache.SharedIndexInformer{
+			"statefulsets":           apps.StatefulSets().Informer(),
+			"deployments":            apps.Deployments().Informer(),
+			"services":               core.Services().Informer(),
+			"configmaps":             core.ConfigMaps().Informer(),
+			"secrets":                core.Secrets().Informer(),
+			"persistentvolumeclaims": core.PersistentVolumeClaims().Informer(),
+			"pods":                   core.Pods().Informer(),
+		},
+	}
+}
+
+// Run starts the informers and, once synced, tracks their staleness until the context is done
+func (c *Cache) Run(ctx context.Context) error {
+	c.factory.Start(ctx.Done())
+	for _, synced := range c.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return errors.New(cacheSyncError)
+		}
+	}
+	c.synced.Store(true)
+	c.trackStaleness(ctx)
+	return nil
+}
+
+// Ready fails until the informers have synced, for the readiness check
+func (c *Cache) Ready() error {
+	if !c.isSynced() {
+		return errors.New(cacheNotSyncedError)
+	}
+	return nil
+}
+
+func (c *Cache) isSynced() bool {
+	return c != nil && c.synced.Load()
+}
+
+// trackStaleness sets the seconds since each informer last advanced its resource version, through
+// events or the bookmarks the apiserver sends on healthy watches
+func (c *Cache) trackStaleness(ctx context.Context) {
+	versions := make(map[string]string, len(c.informers))
+	changed := make(map[string]time.Time, len(c.informers))
+	wait.UntilWithContext(ctx, func(context.Context) {
+		now := time.Now()
+		for resource, informer := range c.informers {
+			if version := informer.LastSyncResourceVersion(); version != versions[resource] || changed[resource].IsZero() {
+				versions[resource] = version
+				changed[resource] = now
+			}
+			_ = c.metrics.SetGaugeMetric(prometheus.MetricCacheStalenessSeconds, now.Sub(changed[resource]).Seconds(), map[string]string{prometheus.LabelResource: resource})
+		}
+	}, cacheStalenessCheck)
+}
+
+// listWorkloads returns a page of the cached workloads of the token kind sorted by name
+func (c *Cache) listWorkloads(namespace string, selector labels.Selector, limit int64, token pageToken) ([]*workload, *pageToken, error) {
+	var workloads []*workload
+	if token.Kind == workloadStatefulSet {
+		statefulSets, err := c.statefulSets.StatefulSets(namespace).List(selector)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, statefulSet := range statefulSets {
+			workloads = append(workloads, fromStatefulSet(statefulSet))
+		}
+	} else {
+		deployments, err := c.deployments.Deployments(namespace).List(selector)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, deployment := range deployments {
+			workloads = append(workloads, fromDeployment(deployment))
+		}
+	}
+	workloads, next := pageWorkloads(workloads, limit, token)
+	return workloads, next, nil
+}
+
+// pageWorkloads returns the workloads sorted by name after the one of the token, along with the
+// token of the next page carrying the name of the last workload of the page
+func pageWorkloads(workloads []*workload, limit int64, token pageToken) ([]*workload, *pageToken) {
+	sort.Slice(workloads, func(i, j int) bool { return workloads[i].name < workloads[j].name })
+	start := sort.Search(len(workloads), func(idx int) bool { return workloads[idx].name > token.After })
+	workloads = workloads[start:]
+	if int64(len(workloads)) > limit {
+		return workloads[:limit], &pageToken{Kind: token.Kind, After: workloads[limit-1].name}
+	}
+	return workloads, nil
+}
+
+// readThrough reads an object from the cache when synced, falling back to the apiserver when missing
+func readThrough[T any](ctx context.Context, cached func(name string) (T, error), live func(context.Context, string, metav1.GetOptions) (T, error), name string) (T, error) {
+	if cached != nil {
+		if object, err := cached(name); err == nil {
+			return object, nil
+		}
+	}
+	return live(ctx, name, metav1.GetOptions{})
+}
+
+func (c *Cache) statefulSet(namespace string) func(string) (*appsv1.StatefulSet, error) {
+	if !c.isSynced() {
+		return nil
+	}
+	return c.statefulSets.StatefulSets(namespace).Get
+}
+
+func (c *Cache) deployment(namespace string) func(string) (*appsv1.Deployment, error) {
+	if !c.isSynced() {
+		return nil
+	}
+	return c.deployments.Deployments(namespace).Get
+}
+
+func (c *Cache) service(namespace string) func(string) (*apiv1.Service, error) {
+	if !c.isSynced() {
+		return nil
+	}
+	return c.services.Services(namespace).Get
+}
+
+func (c *Cache) configMap(namespace string) func(string) (*apiv1.ConfigMap, error) {
+	if !c.isSynced() {
+		return nil
+	}
+	return c.configMaps.ConfigMaps(namespace).Get
+}
+
+func (c *Cache) secret(namespace string) func(string) (*apiv1.Secret, error) {
+	if !c.isSynced() {
+		return nil
+	}
+	return c.secrets.Secrets(namespace).Get
+}
+
+func (c *Cache) claim(namespace string) func(string) (*apiv1.PersistentVolumeClaim, error) {
+	if !c.isSynced() {
+		return nil
+	}
+	return c.claims.PersistentVolumeClaims(namespace).Get
+}
+
+// listClaims lists the claims of an instance, from the apiserver when none are cached
+func (s *Postgres) listClaims(ctx context.Context, namespace string, set labels.Set) ([]apiv1.PersistentVolumeClaim, error) {
+	if c := s.config.Cache; c.isSynced() {
+		claims, err := c.claims.PersistentVolumeClaims(namespace).List(set.AsSelector())
+		if err == nil && len(claims) > 0 {
+			result := make([]apiv1.PersistentVolumeClaim, len(claims))
+			for idx, claim := range claims {
+				result[idx] = *claim
+			}
+			return result, nil
+		}
+	}
+	claims, err := s.kubeClient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: set.String()})
+	if err != nil {
+		return nil, err
+	}
+	return claims.Items, nil
+}
+
+// listPods lists the pods of an instance, from the apiserver when none are cached
+func (s *Postgres) listPods(ctx context.Context, namespace string, set labels.Set) ([]apiv1.Pod, error) {
+	if c := s.config.Cache; c.isSynced() {
+		pods, err := c.pods.Pods(namespace).List(set.AsSelector())
+		if err == nil && len(pods) > 0 {
+			result := make([]apiv1.Pod, len(pods))
+			for idx, pod := range pods {
+				result[idx] = *pod
+			}
+			return result, nil
+		}
+	}
+	pods, err := s.kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: set.String()})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
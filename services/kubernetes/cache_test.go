@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"schwarz/models"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// GIVEN instances created before the cache is started
+func TestCache(t *testing.T) {
+	kubeClient := newFakeClientset()
+	metrics := newTestMetrics(t)
+	postgres := NewPostgres(kubeClient, metrics, PostgresConfig{HostPathStorage: true})
+	var ids []string
+	for range 2 {
+		response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "pass", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce"})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		ids = append(ids, response.ID)
+	}
+
+	// WHEN the cache is not synced THEN it is not ready
+	cache := NewCache(kubeClient, metrics)
+	if err := cache.Ready(); err == nil {
+		t.Errorf("expected error before sync, got nil")
+	}
+
+	// WHEN the cache is synced THEN it is ready
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		if err := cache.Run(ctx); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}()
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return cache.Ready() == nil, nil
+	}); err != nil {
+		t.Fatalf("cache not synced: %v", err)
+	}
+
+	// WHEN an instance is read THEN its objects are not read from the apiserver
+	cached := NewPostgres(kubeClient, metrics, PostgresConfig{HostPathStorage: true, Cache: cache})
+	kubeClient.ClearActions()
+	if _, err := cached.Get(context.Background(), models.GetRequest{ID: ids[0]}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "get" {
+			t.Errorf("expected %s to be read from the cache", action.GetResource().Resource)
+		}
+	}
+
+	// WHEN the instances are listed by pages THEN the cached pages follow each other
+	listed := map[string]bool{}
+	request := models.ListRequest{PageSize: 1}
+	for page := 0; page < len(ids); page++ {
+		response, err := cached.List(context.Background(), request)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(response.Instances) != 1 {
+			t.Fatalf("expected 1 instance on page %d, got %d", page, len(response.Instances))
+		}
+		listed[response.Instances[0].ID] = true
+		request.PageToken = response.NextPageToken
+	}
+	for _, id := range ids {
+		if !listed[id] {
+			t.Errorf("expected instance %s to be listed, got %v", id, listed)
+		}
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "statefulsets" {
+			t.Errorf("expected the StatefulSets to be listed from the cache")
+		}
+	}
+
+	// WHEN a cached page is continued by a replica without cache THEN the next page follows it
+	first, err := cached.List(context.Background(), models.ListRequest{PageSize: 1})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	next, err := postgres.List(context.Background(), models.ListRequest{PageSize: 1, PageToken: first.NextPageToken})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(first.Instances) != 1 || len(next.Instances) != 1 || first.Instances[0].ID == next.Instances[0].ID {
+		t.Errorf("expected the pages to list both instances, got %v and %v", first.Instances, next.Instances)
+	}
+
+	// WHEN a page listed from the apiserver is continued once cached THEN its continue token is sent
+	// to the apiserver again
+	statefulSets, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	pages := []*appsv1.StatefulSetList{
+		{ListMeta: metav1.ListMeta{Continue: "continue"}, Items: statefulSets.Items[:1]},
+		{Items: statefulSets.Items[1:]},
+	}
+	kubeClient.PrependReactor("list", "statefulsets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if len(pages) == 0 {
+			return false, nil, nil
+		}
+		page := pages[0]
+		pages = pages[1:]
+		return true, page, nil
+	})
+	if first, err = postgres.List(context.Background(), models.ListRequest{PageSize: 1}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if next, err = cached.List(context.Background(), models.ListRequest{PageSize: 1, PageToken: first.NextPageToken}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(pages) != 0 {
+		t.Errorf("expected the continued page to be listed from the apiserver")
+	}
+	if len(first.Instances) != 1 || len(next.Instances) != 1 || first.Instances[0].ID == next.Instances[0].ID {
+		t.Errorf("expected the pages to list both instances, got %v and %v", first.Instances, next.Instances)
+	}
+
+	// WHEN the page token isn't one we issued THEN invalidPageTokenError
+	if _, err := cached.List(context.Background(), models.ListRequest{PageSize: 1, PageToken: workloadStatefulSet + "/" + ids[0]}); err == nil || err.Error() != fmt.Sprintf(invalidPageTokenError, workloadStatefulSet+"/"+ids[0]) {
+		t.Errorf("expected error %s, got %v", fmt.Sprintf(invalidPageTokenError, workloadStatefulSet+"/"+ids[0]), err)
+	}
+
+	// WHEN an instance is updated THEN its objects are not read from the apiserver
+	update := models.UpdateRequest{ID: ids[0], UpdateMask: []string{updatePathCPULimit}, Resources: models.Resources{CPULimit: "2"}}
+	kubeClient.ClearActions()
+	if err := cached.Update(context.Background(), update); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "get" {
+			t.Errorf("expected %s to be read from the cache", action.GetResource().Resource)
+		}
+	}
+
+}
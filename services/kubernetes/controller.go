@@ -0,0 +1,356 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"schwarz/models"
+	"schwarz/services/prometheus"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	controllerResync = 10 * time.Minute
+
+	credentialsMissingError = "credentials secret %s not found"
+	cacheSyncError          = "failed to sync the informer caches"
+)
+
+// Controller applies the objects of every PostgresInstance, so they follow its spec and the ones deleted
+// since are created again, and reports their state in the instance status. The instances and their objects are watched through
+// informers, their keys are queued so every instance is reconciled by one worker at a time.
+type Controller struct {
+	postgres          *Postgres
+	instances         dynamic.NamespaceableResourceInterface
+	instanceInformers dynamicinformer.DynamicSharedInformerFactory
+	objectInformers   informers.SharedInformerFactory
+	lister            cache.GenericLister
+	queue             workqueue.RateLimitingInterface
+	validator         *Validator
+}
+
+func NewController(clientset kubernetes.Interface, dynamicClient dynamic.Interface, metrics *prometheus.Prometheus, config PostgresConfig, allowedImages []string) *Controller {
+	instanceInformers := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, controllerResync)
+	// Only the objects of the instances are cached
+	objectInformers := informers.NewSharedInformerFactoryWithOptions(clientset, controllerResync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = labelManagedBy + "=" + labelManagedByValue
+	}))
+	c := &Controller{
+		postgres:          NewPostgres(clientset, metrics, config).(*Postgres),
+		instances:         dynamicClient.Resource(instanceResource),
+		instanceInformers: instanceInformers,
+		objectInformers:   objectInformers,
+		lister:            instanceInformers.ForResource(instanceResource).Lister(),
+		queue:             workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		validator:         NewValidator(nil, allowedImages, config.DefaultResources).(*Validator),
+	}
+	_, _ = instanceInformers.ForResource(instanceResource).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, object any) { c.enqueue(object) },
+	})
+	// Deleted objects are created again, workload changes update the readiness of the instance
+	for _, informer := range []cache.SharedIndexInformer{
+		objectInformers.Apps().V1().StatefulSets().Informer(),
+		objectInformers.Apps().V1().Deployments().Informer(),
+	} {
+		_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(_, object any) { c.enqueueOwner(object) },
+			DeleteFunc: c.enqueueOwner,
+		})
+	}
+	for _, informer := range []cache.SharedIndexInformer{
+		objectInformers.Core().V1().Services().Informer(),
+		objectInformers.Core().V1().ConfigMaps().Informer(),
+		objectInformers.Core().V1().Secrets().Informer(),
+		objectInformers.Core().V1().PersistentVolumeClaims().Informer(),
+		objectInformers.Networking().V1().NetworkPolicies().Informer(),
+		objectInformers.Policy().V1().PodDisruptionBudgets().Informer(),
+	} {
+		_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{DeleteFunc: c.enqueueOwner})
+	}
+	return c
+}
+
+// Run reconciles the instances until the context is done
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	defer c.queue.ShutDown()
+	if err := c.start(ctx); err != nil {
+		return err
+	}
+	log.Printf("instance controller started with %d workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// start runs the informers and waits for their caches
+func (c *Controller) start(ctx context.Context) error {
+	c.instanceInformers.Start(ctx.Done())
+	c.objectInformers.Start(ctx.Done())
+	for _, synced := range c.instanceInformers.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return errors.New(cacheSyncError)
+		}
+	}
+	for _, synced := range c.objectInformers.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return errors.New(cacheSyncError)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+// processNextItem reconciles the next queued instance, queued again with backoff when it fails
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+	if err := c.reconcile(ctx, key.(string)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("reconcile %s failed: %w", key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) enqueue(object any) {
+	key, err := cache.MetaNamespaceKeyFunc(object)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueOwner queues the instance of an object, named after its instance label
+func (c *Controller) enqueueOwner(object any) {
+	if tombstone, ok := object.(cache.DeletedFinalStateUnknown); ok {
+		object = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if id := accessor.GetLabels()[labelInstance]; id != "" {
+		c.queue.Add(accessor.GetNamespace() + "/" + id)
+	}
+}
+
+// reconcile applies the objects of an instance and updates its status
+func (c *Controller) reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	object, err := c.lister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	instance, err := fromUnstructured(object.(*unstructured.Unstructured))
+	if err != nil {
+		return err
+	}
+	// Objects of deleted instances are removed by the Delete request
+	if instance.DeletionTimestamp != nil {
+		return nil
+	}
+	metrics := c.postgres.metrics
+	_ = metrics.IncreaseCounterMetric(prometheus.MetricReconcileTotal, 1, map[string]string{prometheus.LabelID: instance.Name})
+	status := instanceStatus{
+		ObservedGeneration: instance.Generation,
+		ReadyReplicas:      instance.Status.ReadyReplicas,
+		Conditions:         append([]metav1.Condition(nil), instance.Status.Conditions...),
+	}
+	reconciled := metav1.Condition{Type: conditionReconciled, Status: metav1.ConditionTrue, Reason: reasonReconciled, ObservedGeneration: instance.Generation}
+	reason, reconcileErr := c.reconcileObjects(ctx, instance)
+	if reconcileErr != nil {
+		_ = metrics.IncreaseCounterMetric(prometheus.MetricReconcileFailedTotal, 1, map[string]string{prometheus.LabelID: instance.Name})
+		reconciled.Status = metav1.ConditionFalse
+		reconciled.Reason = reason
+		reconciled.Message = reconcileErr.Error()
+		// Retrying can't fix an invalid spec, the instance is reconciled again once it changes
+		if reason == reasonInvalidSpec {
+			reconcileErr = nil
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, reconciled)
+	ready := metav1.Condition{Type: conditionReady, Status: metav1.ConditionFalse, Reason: reasonProvisioning, ObservedGeneration: instance.Generation}
+	if workload, err := c.postgres.getWorkload(ctx, instance.Namespace, instance.Name); err == nil {
+		status.ReadyReplicas = workload.readyReplicas
+		if workload.replicas > 0 && workload.readyReplicas >= workload.replicas {
+			ready.Status = metav1.ConditionTrue
+			ready.Reason = reasonReplicasReady
+		}
+	} else if !apierrors.IsNotFound(err) {
+		reconcileErr = errors.Join(reconcileErr, err)
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+	if equality.Semantic.DeepEqual(status, instance.Status) {
+		return reconcileErr
+	}
+	instance.Status = status
+	updated, err := toUnstructured(instance)
+	if err == nil {
+		_, err = c.instances.Namespace(instance.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{FieldManager: fieldManager})
+	}
+	return errors.Join(reconcileErr, err)
+}
+
+// reconcileObjects applies the objects of an instance, so they follow its spec and the ones deleted
+// by hand are created again, returning the reason of the Reconciled condition when it fails. The Secret
+// is only created along with the instance, since its password is not kept anywhere else.
+func (c *Controller) reconcileObjects(ctx context.Context, instance *postgresInstance) (string, error) {
+	s := c.postgres
+	request := instance.createRequest()
+	secretName := postgresCredentialsPrefix + instance.Name
+	secret, err := s.kubeClient.CoreV1().Secrets(instance.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return reasonCredentialsMissing, fmt.Errorf(credentialsMissingError, secretName)
+	} else if err != nil {
+		return reasonReconcileFailed, err
+	}
+	// Instances written without the service skipped the Validator
+	validated := request
+	validated.UserPass = string(secret.Data[envPostgresPassword])
+	if err := c.validator.validateCreate(validated); err != nil {
+		return reasonInvalidSpec, err
+	}
+	storageClass, err := s.storageClass(ctx, request.StorageClass)
+	if err != nil {
+		return reasonReconcileFailed, err
+	}
+	// Claim templates can't be changed, the claims of an existing StatefulSet are expanded instead
+	capacity := request.Capacity
+	workload, err := s.getWorkload(ctx, instance.Namespace, instance.Name)
+	switch {
+	case err == nil && workload.kind == workloadStatefulSet && len(workload.claimTemplates) > 0:
+		claimTemplate := &workload.claimTemplates[0]
+		request.Capacity = claimCapacity(claimTemplate)
+		if accessModes := claimAccessModes(claimTemplate); len(accessModes) > 0 {
+			request.AccessMode = accessModes[0]
+		}
+		storageClass = derefString(claimTemplate.Spec.StorageClassName)
+	case err != nil && !apierrors.IsNotFound(err):
+		return reasonReconcileFailed, err
+	}
+	if err := s.checkPodSecurity(ctx, instance.Namespace, storageClass == hostPathStorageClass); err != nil {
+		return reasonReconcileFailed, err
+	}
+	for _, step := range s.createSteps(ctx, request, storageClass, instance.Name) {
+		switch step.name {
+		// The objects are adopted below, the Secret by the instance instead of the workload
+		case stepSecret, stepOwnerReferences:
+			continue
+		// Volumes and claims are only created, their capacity is expanded below
+		case stepPersistentVolume, stepPersistentVolumeClaim:
+			exists, err := step.exists(ctx)
+			if err != nil {
+				return reasonReconcileFailed, err
+			}
+			if exists {
+				continue
+			}
+		}
+		if err := step.create(); err != nil {
+			return reasonReconcileFailed, fmt.Errorf(createStepError, step.name, err)
+		}
+	}
+	if err := c.expandStorage(ctx, instance.Namespace, instance.Name, capacity); err != nil {
+		return reasonReconcileFailed, err
+	}
+	if err := c.adoptObjects(ctx, instance); err != nil {
+		return reasonReconcileFailed, err
+	}
+	return "", nil
+}
+
+// expandStorage expands the claims of an instance and their volumes to the capacity of its spec, once
+// any of them has another one
+func (c *Controller) expandStorage(ctx context.Context, namespace, id, capacity string) error {
+	s := c.postgres
+	claims, err := s.listClaims(ctx, namespace, instanceLabels(id, componentStorage))
+	if err != nil {
+		return err
+	}
+	requested := resource.MustParse(capacity)
+	for _, claim := range claims {
+		if current := claim.Spec.Resources.Requests[apiv1.ResourceStorage]; current.Cmp(requested) != 0 {
+			return s.updateStorage(ctx, models.UpdateRequest{ID: id, Namespace: namespace, Capacity: capacity})
+		}
+	}
+	return nil
+}
+
+// adoptObjects makes the instance the controller of its workload, which owns the other objects. The
+// Secret is owned by the instance itself, so it outlives a workload deleted by hand and created again.
+func (c *Controller) adoptObjects(ctx context.Context, instance *postgresInstance) error {
+	s := c.postgres
+	workload, err := s.getWorkload(ctx, instance.Namespace, instance.Name)
+	if err != nil {
+		return err
+	}
+	isController := true
+	blockOwnerDeletion := true
+	instanceOwner := metav1.OwnerReference{
+		APIVersion:         instanceResource.GroupVersion().String(),
+		Kind:               instanceKind,
+		Name:               instance.Name,
+		UID:                instance.UID,
+		Controller:         &isController,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}
+	workloadObject := newInstanceObject[*appsv1.StatefulSet](s.kubeClient.AppsV1().StatefulSets(instance.Namespace), "StatefulSet", workload.name, metav1.DeleteOptions{})
+	if workload.kind == workloadDeployment {
+		workloadObject = newInstanceObject[*appsv1.Deployment](s.kubeClient.AppsV1().Deployments(instance.Namespace), "Deployment", workload.name, metav1.DeleteOptions{})
+	}
+	var owned, secrets []instanceObject
+	for _, object := range s.ownedObjects(instance.Namespace, instance.Name, workload.kind) {
+		if object.kind == "Secret" {
+			secrets = append(secrets, object)
+		} else {
+			owned = append(owned, object)
+		}
+	}
+	if err := setOwner(ctx, append([]instanceObject{workloadObject}, secrets...), instanceOwner); err != nil {
+		return err
+	}
+	return setOwner(ctx, owned, metav1.OwnerReference{
+		APIVersion:         appsv1.SchemeGroupVersion.String(),
+		Kind:               workloadObject.kind,
+		Name:               workload.name,
+		UID:                workload.uid,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	})
+}
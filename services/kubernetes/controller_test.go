@@ -0,0 +1,249 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"schwarz/models"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestController returns the controller and the controller mode service sharing fake clients, with
+// the informers of the controller started
+func newTestController(t *testing.T, instances ...runtime.Object) (*Controller, Service, *fake.Clientset, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	kubeClient := newFakeClientset()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{instanceResource: "PostgresInstanceList"}, instances...)
+	metrics := newTestMetrics(t)
+	config := PostgresConfig{HostPathStorage: true}
+	controller := NewController(kubeClient, dynamicClient, metrics, config, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := controller.start(ctx); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return controller, NewInstances(kubeClient, dynamicClient, metrics, config), kubeClient, dynamicClient
+}
+
+// reconcileInstance reconciles an instance once the informer has it
+func reconcileInstance(t *testing.T, controller *Controller, namespace, id string) error {
+	t.Helper()
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		_, err := controller.lister.ByNamespace(namespace).Get(id)
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("instance %s not cached: %v", id, err)
+	}
+	return controller.reconcile(context.Background(), namespace+"/"+id)
+}
+
+// waitForSpec waits for the informer to have the instance with the edited spec
+func waitForSpec(t *testing.T, controller *Controller, namespace, id string, edited func(instanceSpec) bool) {
+	t.Helper()
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		object, err := controller.lister.ByNamespace(namespace).Get(id)
+		if err != nil {
+			return false, nil
+		}
+		instance, err := fromUnstructured(object.(*unstructured.Unstructured))
+		return err == nil && edited(instance.Spec), nil
+	})
+	if err != nil {
+		t.Fatalf("instance %s spec not cached: %v", id, err)
+	}
+}
+
+func getInstance(t *testing.T, dynamicClient *dynamicfake.FakeDynamicClient, namespace, id string) *postgresInstance {
+	t.Helper()
+	object, err := dynamicClient.Resource(instanceResource).Namespace(namespace).Get(context.Background(), id, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	instance, err := fromUnstructured(object)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return instance
+}
+
+// GIVEN a PostgresInstance created in controller mode
+func TestControllerReconcile(t *testing.T) {
+	controller, service, kubeClient, dynamicClient := newTestController(t)
+	request := models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "password", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce"}
+	response, err := service.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	namespace := metav1.NamespaceDefault
+	if _, err := kubeClient.CoreV1().Secrets(namespace).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the credentials Secret to be created along with the instance, got error %v", err)
+	}
+	if _, err := kubeClient.AppsV1().StatefulSets(namespace).Get(context.Background(), response.ID, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected the StatefulSet to be left to the controller")
+	}
+	if response.Endpoint != (models.Endpoint{}) {
+		t.Errorf("expected the endpoint to be empty until the Service is created, got %v", response.Endpoint)
+	}
+
+	// WHEN the instance is reconciled THEN its objects are created and owned by the instance
+	if err := reconcileInstance(t, controller, namespace, response.ID); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	statefulSet, err := kubeClient.AppsV1().StatefulSets(namespace).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the StatefulSet to be created, got error %v", err)
+	}
+	if owner := metav1.GetControllerOf(statefulSet); owner == nil || owner.Kind != instanceKind || owner.Name != response.ID {
+		t.Errorf("expected the StatefulSet to be controlled by the instance, got owner references %v", statefulSet.OwnerReferences)
+	}
+	// The Secret outlives a workload deleted by hand, the password isn't kept anywhere else
+	secret, _ := kubeClient.CoreV1().Secrets(namespace).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{})
+	if owner := metav1.GetControllerOf(secret); len(secret.OwnerReferences) != 1 || owner == nil || owner.Kind != instanceKind || owner.Name != response.ID {
+		t.Errorf("expected the Secret to be owned by the instance only, got owner references %v", secret.OwnerReferences)
+	}
+	liveService, _ := kubeClient.CoreV1().Services(namespace).Get(context.Background(), postgresPrefix+response.ID, metav1.GetOptions{})
+	if len(liveService.OwnerReferences) != 1 || liveService.OwnerReferences[0].Kind != "StatefulSet" {
+		t.Errorf("expected the Service to be owned by the StatefulSet, got owner references %v", liveService.OwnerReferences)
+	}
+	instance := getInstance(t, dynamicClient, namespace, response.ID)
+	if !meta.IsStatusConditionTrue(instance.Status.Conditions, conditionReconciled) {
+		t.Errorf("expected condition %s to be true, got conditions %v", conditionReconciled, instance.Status.Conditions)
+	}
+	if condition := meta.FindStatusCondition(instance.Status.Conditions, conditionReady); condition == nil || condition.Reason != reasonProvisioning {
+		t.Errorf("expected condition %s with reason %s, got conditions %v", conditionReady, reasonProvisioning, instance.Status.Conditions)
+	}
+
+	// WHEN an object is deleted by hand THEN it is created again
+	if err := kubeClient.CoreV1().Services(namespace).Delete(context.Background(), postgresPrefix+response.ID, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := reconcileInstance(t, controller, namespace, response.ID); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := kubeClient.CoreV1().Services(namespace).Get(context.Background(), postgresPrefix+response.ID, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the Service to be created again, got error %v", err)
+	}
+
+	// WHEN the instance is updated THEN only the spec is patched, the objects follow it once reconciled
+	if err := service.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathReplicas}, Replicas: 2}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if replicas := getInstance(t, dynamicClient, namespace, response.ID).Spec.Replicas; replicas != 2 {
+		t.Errorf("expected spec replicas = 2, got %d", replicas)
+	}
+	if statefulSet, _ := kubeClient.AppsV1().StatefulSets(namespace).Get(context.Background(), response.ID, metav1.GetOptions{}); *statefulSet.Spec.Replicas != 1 {
+		t.Errorf("expected the StatefulSet to be left to the controller, got replicas = %d", *statefulSet.Spec.Replicas)
+	}
+	waitForSpec(t, controller, namespace, response.ID, func(spec instanceSpec) bool { return spec.Replicas == 2 })
+	if err := reconcileInstance(t, controller, namespace, response.ID); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if statefulSet, _ := kubeClient.AppsV1().StatefulSets(namespace).Get(context.Background(), response.ID, metav1.GetOptions{}); *statefulSet.Spec.Replicas != 2 {
+		t.Errorf("expected StatefulSet replicas = 2, got %d", *statefulSet.Spec.Replicas)
+	}
+	podDisruptionBudget, err := kubeClient.PolicyV1().PodDisruptionBudgets(namespace).Get(context.Background(), postgresDisruptionBudgetPrefix+response.ID, metav1.GetOptions{})
+	if err != nil || podDisruptionBudget.Spec.MinAvailable == nil || podDisruptionBudget.Spec.MinAvailable.IntValue() != 1 {
+		t.Errorf("expected PodDisruptionBudget minAvailable = 1, got %v (error %v)", podDisruptionBudget, err)
+	}
+
+	// WHEN the spec is edited by hand THEN the objects follow it once reconciled, the claims are expanded
+	// while the claim templates are kept
+	claim := setPersistentVolumeClaim("10Mi", []string{"ReadWriteOnce"}, hostPathStorageClass, response.ID)
+	claim.Name = postgresDataVolume + "-" + response.ID + "-0"
+	if _, err := kubeClient.CoreV1().PersistentVolumeClaims(namespace).Create(context.Background(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	patch := []byte(`{"spec":{"portNum":5433,"capacity":"20Mi"}}`)
+	if _, err := dynamicClient.Resource(instanceResource).Namespace(namespace).Patch(context.Background(), response.ID, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	waitForSpec(t, controller, namespace, response.ID, func(spec instanceSpec) bool { return spec.Capacity == "20Mi" })
+	if err := reconcileInstance(t, controller, namespace, response.ID); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	liveService, _ = kubeClient.CoreV1().Services(namespace).Get(context.Background(), postgresPrefix+response.ID, metav1.GetOptions{})
+	if len(liveService.Spec.Ports) == 0 || liveService.Spec.Ports[0].Port != 5433 {
+		t.Errorf("expected Service port 5433, got ports %v", liveService.Spec.Ports)
+	}
+	statefulSet, _ = kubeClient.AppsV1().StatefulSets(namespace).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if port := containerPort(&statefulSet.Spec.Template); port != 5433 {
+		t.Errorf("expected container port 5433, got %d", port)
+	}
+	if capacity := claimCapacity(&statefulSet.Spec.VolumeClaimTemplates[0]); capacity != "10Mi" {
+		t.Errorf("expected the claim template capacity to be kept, got %s", capacity)
+	}
+	claim, _ = kubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), claim.Name, metav1.GetOptions{})
+	if capacity := claimCapacity(claim); capacity != "20Mi" {
+		t.Errorf("expected the claim to be expanded to 20Mi, got %s", capacity)
+	}
+	if instance := getInstance(t, dynamicClient, namespace, response.ID); !meta.IsStatusConditionTrue(instance.Status.Conditions, conditionReconciled) {
+		t.Errorf("expected condition %s to be true, got conditions %v", conditionReconciled, instance.Status.Conditions)
+	}
+
+	// WHEN the instance is deleted THEN the PostgresInstance is deleted first
+	deleted, err := service.Delete(context.Background(), models.DeleteRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(deleted.Objects) == 0 || deleted.Objects[0].Kind != instanceKind || deleted.Objects[0].Result != models.DeleteResultDeleted {
+		t.Errorf("expected the %s to be deleted first, got %v", instanceKind, deleted.Objects)
+	}
+}
+
+// GIVEN a PostgresInstance without credentials Secret
+func TestControllerReconcileCredentialsMissing(t *testing.T) {
+	object, err := toUnstructured(newPostgresInstance(models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Namespace: metav1.NamespaceDefault}, "missing"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	controller, _, kubeClient, dynamicClient := newTestController(t, object)
+
+	// WHEN the instance is reconciled THEN no object is created and the reason is reported
+	if err := reconcileInstance(t, controller, metav1.NamespaceDefault, "missing"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if _, err := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), "missing", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected no StatefulSet without credentials")
+	}
+	instance := getInstance(t, dynamicClient, metav1.NamespaceDefault, "missing")
+	if condition := meta.FindStatusCondition(instance.Status.Conditions, conditionReconciled); condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != reasonCredentialsMissing {
+		t.Errorf("expected condition %s false with reason %s, got conditions %v", conditionReconciled, reasonCredentialsMissing, instance.Status.Conditions)
+	}
+}
+
+// GIVEN a PostgresInstance written without the service
+func TestControllerReconcileInvalidSpec(t *testing.T) {
+	request := models.CreateRequest{DBName: "dbName", UserName: "user", PortNum: 80, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Namespace: metav1.NamespaceDefault}
+	object, err := toUnstructured(newPostgresInstance(request, "invalid"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	controller, _, kubeClient, dynamicClient := newTestController(t, object)
+	if _, err := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Create(context.Background(), setSecret("user", "password", "invalid"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN the spec breaks the Validator rules THEN no object is created and the failure is reported
+	if err := reconcileInstance(t, controller, metav1.NamespaceDefault, "invalid"); err != nil {
+		t.Errorf("expected the invalid spec not to be retried, got error %v", err)
+	}
+	if _, err := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), "invalid", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected no StatefulSet for an invalid spec")
+	}
+	instance := getInstance(t, dynamicClient, metav1.NamespaceDefault, "invalid")
+	condition := meta.FindStatusCondition(instance.Status.Conditions, conditionReconciled)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != reasonInvalidSpec || condition.Message != fmt.Sprintf(invalidPortNumError, 80) {
+		t.Errorf("expected condition %s false with reason %s, got conditions %v", conditionReconciled, reasonInvalidSpec, instance.Status.Conditions)
+	}
+}
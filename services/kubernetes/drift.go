@@ -0,0 +1,470 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"schwarz/models"
+	"schwarz/services/prometheus"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// annotationDriftRepair set to disabled on the workload leaves the drift of an instance to be repaired by hand
+	annotationDriftRepair = "schwarz/drift-repair"
+	driftRepairDisabled   = "disabled"
+
+	driftObjectError = "compare %s %s failed: %w"
+)
+
+// driftObject pairs a live object of an instance with the object the generators produce for it
+type driftObject struct {
+	kind    string
+	name    string
+	desired runtime.Object
+	live    runtime.Object // Nil when missing
+	legacy  []string       // Paths of the fields the live object predates, kept as they are
+	repair  func(ctx context.Context) error
+}
+
+// drift returns the fields of the live object differing from the desired one, nil when it matches
+// and needs no migration
+func (o driftObject) drift() (*models.DriftedObject, error) {
+	drifted := &models.DriftedObject{Kind: o.kind, Name: o.name}
+	if o.live == nil {
+		drifted.Missing = true
+		return drifted, nil
+	}
+	fields, err := driftedFields(o.desired, o.live)
+	if err != nil || len(fields) == 0 && len(o.legacy) == 0 {
+		return nil, err
+	}
+	drifted.Fields = fields
+	drifted.LegacyFields = o.legacy
+	return drifted, nil
+}
+
+func (s *Postgres) Drift(ctx context.Context, request models.DriftRequest) (models.DriftResponse, error) {
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "drift"})
+	objects, err := s.driftObjects(ctx, s.namespace(request.Namespace, ""), request.ID)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "drift"})
+		return models.DriftResponse{}, err
+	}
+	var response models.DriftResponse
+	for _, object := range objects {
+		drifted, err := object.drift()
+		if err != nil {
+			return models.DriftResponse{}, fmt.Errorf(driftObjectError, object.kind, object.name, err)
+		}
+		if drifted != nil {
+			response.Objects = append(response.Objects, *drifted)
+		}
+	}
+	return response, nil
+}
+
+// driftObjects generates the workload, Service, claims and Secret of an instance again. The values
+// requested at creation or by later updates are only kept on the live objects, so they are read back
+// from them; drift is found in every other field the generators set.
+func (s *Postgres) driftObjects(ctx context.Context, namespace, id string) ([]driftObject, error) {
+	core := s.kubeClient.CoreV1()
+	var objects []driftObject
+	var template *apiv1.PodTemplateSpec
+	isStatefulSet := true
+	statefulSet, err := s.kubeClient.AppsV1().StatefulSets(namespace).Get(ctx, id, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		template = &statefulSet.Spec.Template
+		desired := setStatefulSet(derefReplicas(statefulSet.Spec.Replicas), containerPort(template), claimCapacity(&statefulSet.Spec.VolumeClaimTemplates[0]),
+			claimAccessModes(&statefulSet.Spec.VolumeClaimTemplates[0]), derefString(statefulSet.Spec.VolumeClaimTemplates[0].Spec.StorageClassName), id, statefulSet.Labels[labelOwner])
+		keepRequested(&desired.Spec.Template, template, isHostPath(&desired.Spec.VolumeClaimTemplates[0]))
+		legacy := keepLegacy(&desired.Spec.Template, template)
+		keepAnnotations(desired, statefulSet)
+		objects = append(objects, driftObject{kind: "StatefulSet", name: id, desired: desired, live: statefulSet, legacy: legacy, repair: func(ctx context.Context) error {
+			return apply(ctx, s.kubeClient.AppsV1().StatefulSets(namespace).Apply, desired)
+		}})
+	case apierrors.IsNotFound(err):
+		deployment, err := s.kubeClient.AppsV1().Deployments(namespace).Get(ctx, id, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		claim, err := core.PersistentVolumeClaims(namespace).Get(ctx, postgresVolumeClaimPrefix+id, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		isStatefulSet = false
+		template = &deployment.Spec.Template
+		desired := setDeployment(derefReplicas(deployment.Spec.Replicas), containerPort(template), id, deployment.Labels[labelOwner])
+		keepRequested(&desired.Spec.Template, template, err == nil && isHostPath(claim))
+		legacy := keepLegacy(&desired.Spec.Template, template)
+		keepAnnotations(desired, deployment)
+		objects = append(objects, driftObject{kind: "Deployment", name: id, desired: desired, live: deployment, legacy: legacy, repair: func(ctx context.Context) error {
+			return apply(ctx, s.kubeClient.AppsV1().Deployments(namespace).Apply, desired)
+		}})
+	default:
+		return nil, err
+	}
+	port := containerPort(template)
+
+	service := setService(port, id)
+	if isStatefulSet {
+		setPrimaryService(service, id)
+	}
+	liveService, err := core.Services(namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	object := driftObject{kind: "Service", name: service.Name, desired: service, repair: func(ctx context.Context) error {
+		return apply(ctx, core.Services(namespace).Apply, service)
+	}}
+	if err == nil {
+		// Load balancer annotations are requested, so the live ones are kept
+		setExposure(service, getEndpoint(liveService).Exposure, liveService.Annotations)
+		keepAnnotations(service, liveService)
+		object.live = liveService
+	}
+	objects = append(objects, object)
+
+	claims, err := core.PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set(instanceLabels(id, componentStorage)).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for idx := range claims.Items {
+		claim := &claims.Items[idx]
+		desired := setPersistentVolumeClaim(claimCapacity(claim), claimAccessModes(claim), derefString(claim.Spec.StorageClassName), id)
+		desired.Name = claim.Name
+		keepAnnotations(desired, claim)
+		objects = append(objects, driftObject{kind: "PersistentVolumeClaim", name: claim.Name, desired: desired, live: claim, repair: func(ctx context.Context) error {
+			return apply(ctx, core.PersistentVolumeClaims(namespace).Apply, desired)
+		}})
+	}
+
+	// The credentials can't be generated again, a missing Secret is only reported
+	secret, err := core.Secrets(namespace).Get(ctx, postgresCredentialsPrefix+id, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		objects = append(objects, driftObject{kind: "Secret", name: postgresCredentialsPrefix + id})
+	case err != nil:
+		return nil, err
+	default:
+		desired := setSecret(string(secret.Data[envPostgresUser]), string(secret.Data[envPostgresPassword]), id)
+		if password, ok := secret.Data[envPostgresReplicationPassword]; ok {
+			desired.Data[envPostgresReplicationPassword] = password
+		}
+		keepAnnotations(desired, secret)
+		objects = append(objects, driftObject{kind: "Secret", name: secret.Name, desired: desired, live: secret, repair: func(ctx context.Context) error {
+			return apply(ctx, core.Secrets(namespace).Apply, desired)
+		}})
+	}
+	return objects, nil
+}
+
+// keepRequested sets the generated pod template up with the requested values of the live one: the
+// resources, probes, scheduling and images.
+func keepRequested(desired, live *apiv1.PodTemplateSpec, hostPath bool) {
+	setResources(desired, getResources(live))
+	setProbes(desired, getProbes(live))
+	setPodSecurity(desired, hostPath)
+	desired.Spec.NodeSelector = live.Spec.NodeSelector
+	desired.Spec.Tolerations = live.Spec.Tolerations
+	desired.Spec.Affinity = live.Spec.Affinity
+	desired.Spec.TopologySpreadConstraints = live.Spec.TopologySpreadConstraints
+	keepImages(desired.Spec.Containers, live.Spec.Containers)
+	keepImages(desired.Spec.InitContainers, live.Spec.InitContainers)
+}
+
+// keepLegacy keeps the fields of pod templates created before they were generated: PGDATA at the root
+// of the volume, credentials read from the ConfigMap, no security context and no probes. Applying the
+// generated ones would orphan the data directory or read a Secret which may not exist, so they are left
+// to a migration and reported instead. The paths of the kept fields are returned.
+func keepLegacy(desired, live *apiv1.PodTemplateSpec) []string {
+	var legacy []string
+	if live.Spec.SecurityContext == nil && desired.Spec.SecurityContext != nil {
+		desired.Spec.SecurityContext = nil
+		legacy = append(legacy, "spec.template.spec.securityContext")
+	}
+	for kind, containers := range map[string][]apiv1.Container{"initContainers": desired.Spec.InitContainers, "containers": desired.Spec.Containers} {
+		liveContainers := live.Spec.Containers
+		if kind == "initContainers" {
+			liveContainers = live.Spec.InitContainers
+		}
+		for idx := range containers {
+			container := &containers[idx]
+			current, ok := findContainer(liveContainers, container.Name)
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("spec.template.spec.%s[%s]", kind, container.Name)
+			for _, name := range []string{envPGData, envPostgresUser, envPostgresPassword} {
+				if hasEnv(*container, name) && !hasEnv(current, name) {
+					removeEnv(container, name)
+					legacy = append(legacy, fmt.Sprintf("%s.env[%s]", path, name))
+				}
+			}
+			if container.SecurityContext != nil && current.SecurityContext == nil {
+				container.SecurityContext = nil
+				legacy = append(legacy, path+".securityContext")
+			}
+			if container.LivenessProbe != nil && current.LivenessProbe == nil {
+				container.StartupProbe, container.ReadinessProbe, container.LivenessProbe = nil, nil, nil
+				legacy = append(legacy, path+".startupProbe", path+".readinessProbe", path+".livenessProbe")
+			}
+		}
+	}
+	sort.Strings(legacy)
+	return legacy
+}
+
+func findContainer(containers []apiv1.Container, name string) (apiv1.Container, bool) {
+	for _, container := range containers {
+		if container.Name == name {
+			return container, true
+		}
+	}
+	return apiv1.Container{}, false
+}
+
+func removeEnv(container *apiv1.Container, name string) {
+	env := container.Env[:0]
+	for _, value := range container.Env {
+		if value.Name != name {
+			env = append(env, value)
+		}
+	}
+	container.Env = env
+}
+
+func keepImages(desired, live []apiv1.Container) {
+	for idx := range desired {
+		for _, container := range live {
+			if container.Name == desired[idx].Name {
+				desired[idx].Image = container.Image
+			}
+		}
+	}
+}
+
+// keepAnnotations copies the annotations set along with the live object, so a repair doesn't drop them
+func keepAnnotations(desired, live metav1.Object) {
+	annotations := desired.GetAnnotations()
+	for _, key := range []string{annotationRequestID, annotationSpecHash} {
+		if value, ok := live.GetAnnotations()[key]; ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[key] = value
+		}
+	}
+	desired.SetAnnotations(annotations)
+}
+
+// driftedFields compares the fields set by the generators, along with the labels. Fields defaulted or
+// added by anyone else are not drift.
+func driftedFields(desired, live runtime.Object) ([]string, error) {
+	desiredFields, err := generatedFields(desired)
+	if err != nil {
+		return nil, err
+	}
+	liveFields, err := generatedFields(live)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	compareFields("", desiredFields, liveFields, &fields)
+	sort.Strings(fields)
+	return fields, nil
+}
+
+func generatedFields(object runtime.Object) (map[string]any, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	metadata, _ := fields["metadata"].(map[string]any)
+	fields["metadata"] = map[string]any{"labels": metadata["labels"]}
+	for _, field := range []string{"apiVersion", "kind", "status"} {
+		delete(fields, field)
+	}
+	return fields, nil
+}
+
+// compareFields appends the path of every desired field the live object lacks or sets otherwise. List
+// items are matched by name when they have one, like containers, and by position otherwise.
+func compareFields(path string, desired, live any, fields *[]string) {
+	switch desiredValue := desired.(type) {
+	case nil:
+	case map[string]any:
+		liveValue, _ := live.(map[string]any)
+		for key, value := range desiredValue {
+			compareFields(strings.TrimPrefix(path+"."+key, "."), value, liveValue[key], fields)
+		}
+	case []any:
+		liveValue, _ := live.([]any)
+		for idx, item := range desiredValue {
+			name, ok := itemName(item)
+			if !ok {
+				var liveItem any
+				if idx < len(liveValue) {
+					liveItem = liveValue[idx]
+				}
+				compareFields(fmt.Sprintf("%s[%d]", path, idx), item, liveItem, fields)
+				continue
+			}
+			var liveItem any
+			for _, candidate := range liveValue {
+				if candidateName, _ := itemName(candidate); candidateName == name {
+					liveItem = candidate
+				}
+			}
+			compareFields(fmt.Sprintf("%s[%s]", path, name), item, liveItem, fields)
+		}
+	default:
+		if !reflect.DeepEqual(desired, live) {
+			*fields = append(*fields, path)
+		}
+	}
+}
+
+func itemName(item any) (string, bool) {
+	fields, _ := item.(map[string]any)
+	name, ok := fields["name"].(string)
+	return name, ok && name != ""
+}
+
+func containerPort(template *apiv1.PodTemplateSpec) int32 {
+	if containers := template.Spec.Containers; len(containers) > 0 && len(containers[0].Ports) > 0 {
+		return containers[0].Ports[0].ContainerPort
+	}
+	return 0
+}
+
+func claimCapacity(claim *apiv1.PersistentVolumeClaim) string {
+	capacity := claim.Spec.Resources.Requests[apiv1.ResourceStorage]
+	return capacity.String()
+}
+
+func claimAccessModes(claim *apiv1.PersistentVolumeClaim) []string {
+	accessModes := make([]string, len(claim.Spec.AccessModes))
+	for idx, accessMode := range claim.Spec.AccessModes {
+		accessModes[idx] = string(accessMode)
+	}
+	return accessModes
+}
+
+func derefReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// DriftDetector periodically compares the objects of every instance with the generated ones, exposing
+// the number of drifted objects as a metric. When repair is enabled, drifted objects are applied again
+// unless the instance opted out with the drift-repair annotation.
+type DriftDetector struct {
+	postgres *Postgres
+	repair   bool
+}
+
+func NewDriftDetector(clientset kubernetes.Interface, metrics *prometheus.Prometheus, config PostgresConfig, repair bool) *DriftDetector {
+	return &DriftDetector{
+		postgres: NewPostgres(clientset, metrics, config).(*Postgres),
+		repair:   repair,
+	}
+}
+
+// Run checks the instances every interval until the context is done
+func (d *DriftDetector) Run(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, d.detect, interval)
+}
+
+// detect checks the instances of every namespace
+func (d *DriftDetector) detect(ctx context.Context) {
+	s := d.postgres
+	options := metav1.ListOptions{LabelSelector: labels.Set{labelManagedBy: labelManagedByValue, labelComponent: componentDatabase}.String()}
+	var workloads []metav1.ObjectMeta
+	statefulSets, err := s.kubeClient.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, options)
+	if err != nil {
+		log.Printf("failed to list instances for drift detection: %v", err)
+		return
+	}
+	for _, statefulSet := range statefulSets.Items {
+		workloads = append(workloads, statefulSet.ObjectMeta)
+	}
+	deployments, err := s.kubeClient.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, options)
+	if err != nil {
+		log.Printf("failed to list instances for drift detection: %v", err)
+		return
+	}
+	for _, deployment := range deployments.Items {
+		workloads = append(workloads, deployment.ObjectMeta)
+	}
+	for _, workload := range workloads {
+		repair := d.repair && workload.Annotations[annotationDriftRepair] != driftRepairDisabled
+		if err := d.detectInstance(ctx, workload.Namespace, workload.Name, repair); err != nil {
+			log.Printf("drift detection of instance %s/%s failed: %v", workload.Namespace, workload.Name, err)
+		}
+	}
+}
+
+// detectInstance sets the drift metric of an instance, repairing the drifted objects when asked to
+func (d *DriftDetector) detectInstance(ctx context.Context, namespace, id string, repair bool) error {
+	s := d.postgres
+	objects, err := s.driftObjects(ctx, namespace, id)
+	if err != nil {
+		return err
+	}
+	var drifted int
+	for _, object := range objects {
+		result, err := object.drift()
+		if err != nil {
+			return fmt.Errorf(driftObjectError, object.kind, object.name, err)
+		}
+		if result == nil {
+			continue
+		}
+		if len(result.LegacyFields) > 0 {
+			log.Printf("%s %s predates %v, kept until migrated", object.kind, object.name, result.LegacyFields)
+		}
+		if len(result.Fields) == 0 {
+			continue
+		}
+		drifted++
+		if !repair || object.repair == nil {
+			continue
+		}
+		if err := object.repair(ctx); err != nil {
+			log.Printf("repair of %s %s failed: %v", object.kind, object.name, err)
+			continue
+		}
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDriftRepairedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelKind: object.kind})
+	}
+	_ = s.metrics.SetGaugeMetric(prometheus.MetricDriftedObjects, float64(drifted), map[string]string{prometheus.LabelID: id})
+	return nil
+}
@@ -0,0 +1,188 @@
+package kubernetes
+
+import (
+	"context"
+	"schwarz/models"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// GIVEN the objects of an instance changed by hand
+func TestDrift(t *testing.T) {
+	kubeClient := newFakeClientset()
+	metrics := newTestMetrics(t)
+	postgres := NewPostgres(kubeClient, metrics, PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "pass", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Workload: workloadDeployment})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	namespace := metav1.NamespaceDefault
+
+	// WHEN nothing changed THEN no drift is reported
+	drift, err := postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(drift.Objects) != 0 {
+		t.Errorf("expected no drift, got %v", drift.Objects)
+	}
+
+	// WHEN the Service selector and the Deployment security context are changed THEN the fields are reported
+	patches := map[string]func() error{
+		"service": func() error {
+			_, err := kubeClient.CoreV1().Services(namespace).Patch(context.Background(), postgresPrefix+response.ID, types.MergePatchType, []byte(`{"spec":{"selector":{"app":"other"}}}`), metav1.PatchOptions{})
+			return err
+		},
+		"deployment": func() error {
+			_, err := kubeClient.AppsV1().Deployments(namespace).Patch(context.Background(), response.ID, types.MergePatchType, []byte(`{"spec":{"template":{"spec":{"securityContext":{"runAsNonRoot":false}}}}}`), metav1.PatchOptions{})
+			return err
+		},
+	}
+	for name, patch := range patches {
+		if err := patch(); err != nil {
+			t.Fatalf("unexpected error patching %s: %v", name, err)
+		}
+	}
+	drift, err = postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []models.DriftedObject{
+		{Kind: "Deployment", Name: response.ID, Fields: []string{"spec.template.spec.securityContext.runAsNonRoot"}},
+		{Kind: "Service", Name: postgresPrefix + response.ID, Fields: []string{"spec.selector.app"}},
+	}
+	if diff := cmp.Diff(expected, drift.Objects); diff != "" {
+		t.Errorf("drift has diff %s", diff)
+	}
+
+	// WHEN the instance opted out of the repair THEN the drift is only counted
+	detector := NewDriftDetector(kubeClient, metrics, PostgresConfig{HostPathStorage: true}, true)
+	if _, err := kubeClient.AppsV1().Deployments(namespace).Patch(context.Background(), response.ID, types.MergePatchType, []byte(`{"metadata":{"annotations":{"`+annotationDriftRepair+`":"`+driftRepairDisabled+`"}}}`), metav1.PatchOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	detector.detect(context.Background())
+	if drift, _ = postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID}); len(drift.Objects) != 2 {
+		t.Errorf("expected drift to be kept, got %v", drift.Objects)
+	}
+
+	// WHEN the drift is repaired THEN the generated fields are applied again
+	if _, err := kubeClient.AppsV1().Deployments(namespace).Patch(context.Background(), response.ID, types.MergePatchType, []byte(`{"metadata":{"annotations":{"`+annotationDriftRepair+`":null}}}`), metav1.PatchOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	detector.detect(context.Background())
+	if drift, _ = postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID}); len(drift.Objects) != 0 {
+		t.Errorf("expected drift to be repaired, got %v", drift.Objects)
+	}
+
+	// WHEN the Secret is deleted THEN it is reported missing
+	if err := kubeClient.CoreV1().Secrets(namespace).Delete(context.Background(), postgresCredentialsPrefix+response.ID, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	drift, _ = postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID})
+	if len(drift.Objects) != 1 || drift.Objects[0].Kind != "Secret" || !drift.Objects[0].Missing {
+		t.Errorf("expected the Secret to be missing, got %v", drift.Objects)
+	}
+}
+
+// GIVEN a StatefulSet instance left as created
+func TestDriftStatefulSet(t *testing.T) {
+	postgres := NewPostgres(newFakeClientset(), newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	request := models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "pass", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Exposure: exposureNodePort}
+	request.Resources = models.Resources{CPULimit: "2"}
+	request.Scheduling = models.Scheduling{NodeSelector: map[string]string{"disk": "ssd"}}
+	response, err := postgres.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN the instance is updated THEN the requested values are not drift
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathImageTag, updatePathReplicas}, ImageTag: "16", Replicas: 3}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	drift, err := postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(drift.Objects) != 0 {
+		t.Errorf("expected no drift, got %v", drift.Objects)
+	}
+}
+
+// GIVEN a Deployment created before the data directory, credentials Secret and security context were generated
+func TestDriftLegacy(t *testing.T) {
+	kubeClient := newFakeClientset()
+	metrics := newTestMetrics(t)
+	postgres := NewPostgres(kubeClient, metrics, PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "pass", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Workload: workloadDeployment})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	namespace := metav1.NamespaceDefault
+	deployment, err := kubeClient.AppsV1().Deployments(namespace).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	template := &deployment.Spec.Template
+	template.Spec.SecurityContext = nil
+	container := &template.Spec.Containers[0]
+	container.SecurityContext = nil
+	container.StartupProbe, container.ReadinessProbe, container.LivenessProbe = nil, nil, nil
+	for _, name := range []string{envPGData, envPostgresUser, envPostgresPassword} {
+		removeEnv(container, name)
+	}
+	container.VolumeMounts = nil
+	if _, err := kubeClient.AppsV1().Deployments(namespace).Update(context.Background(), deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN the drift is reported THEN the legacy fields are kept apart from the drifted ones
+	drift, err := postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	prefix := "spec.template.spec.containers[postgres]"
+	expected := []models.DriftedObject{{
+		Kind:   "Deployment",
+		Name:   response.ID,
+		Fields: []string{prefix + ".volumeMounts[postgresdata].mountPath", prefix + ".volumeMounts[postgresdata].name"},
+		LegacyFields: []string{
+			prefix + ".env[" + envPGData + "]",
+			prefix + ".env[" + envPostgresPassword + "]",
+			prefix + ".env[" + envPostgresUser + "]",
+			prefix + ".livenessProbe",
+			prefix + ".readinessProbe",
+			prefix + ".securityContext",
+			prefix + ".startupProbe",
+			"spec.template.spec.securityContext",
+		},
+	}}
+	if diff := cmp.Diff(expected, drift.Objects); diff != "" {
+		t.Errorf("drift has diff %s", diff)
+	}
+
+	// WHEN the drift is repaired THEN the legacy fields are not applied
+	NewDriftDetector(kubeClient, metrics, PostgresConfig{HostPathStorage: true}, true).detect(context.Background())
+	deployment, err = kubeClient.AppsV1().Deployments(namespace).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	container = &deployment.Spec.Template.Spec.Containers[0]
+	if len(container.VolumeMounts) == 0 {
+		t.Errorf("expected the volume mounts to be repaired")
+	}
+	for _, name := range []string{envPGData, envPostgresUser, envPostgresPassword} {
+		if hasEnv(*container, name) {
+			t.Errorf("expected %s not to be applied", name)
+		}
+	}
+	if deployment.Spec.Template.Spec.SecurityContext != nil || container.SecurityContext != nil || container.LivenessProbe != nil {
+		t.Errorf("expected the security context and probes not to be applied")
+	}
+	drift, _ = postgres.Drift(context.Background(), models.DriftRequest{ID: response.ID})
+	if len(drift.Objects) != 1 || len(drift.Objects[0].Fields) != 0 || len(drift.Objects[0].LegacyFields) != len(expected[0].LegacyFields) {
+		t.Errorf("expected only the legacy fields to be reported, got %v", drift.Objects)
+	}
+}
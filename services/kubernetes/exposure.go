@@ -0,0 +1,66 @@
+package kubernetes
+
+import (
+	"fmt"
+	"schwarz/models"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	exposureClusterIP    = "clusterip"
+	exposureNodePort     = "nodeport"
+	exposureLoadBalancer = "loadbalancer"
+	exposureHeadless     = "headless"
+)
+
+// setExposure sets how the instance is reached, only reachable inside the cluster unless
+// a NodePort or LoadBalancer is requested.
+func setExposure(service *apiv1.Service, exposure string, annotations map[string]string) {
+	switch strings.ToLower(exposure) {
+	case exposureNodePort:
+		service.Spec.Type = apiv1.ServiceTypeNodePort
+	case exposureLoadBalancer:
+		service.Spec.Type = apiv1.ServiceTypeLoadBalancer
+		// Cloud providers read the load balancer settings from the Service annotations
+		if len(annotations) > 0 && service.Annotations == nil {
+			service.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			service.Annotations[key] = value
+		}
+	case exposureHeadless:
+		service.Spec.Type = apiv1.ServiceTypeClusterIP
+		service.Spec.ClusterIP = apiv1.ClusterIPNone
+	default:
+		service.Spec.Type = apiv1.ServiceTypeClusterIP
+	}
+}
+
+// getEndpoint returns where clients reach a Service, the external address of a LoadBalancer
+// is only set once the cloud provider has assigned it.
+func getEndpoint(service *apiv1.Service) models.Endpoint {
+	endpoint := models.Endpoint{
+		Exposure: strings.ToLower(string(service.Spec.Type)),
+		DNSName:  fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace),
+	}
+	if service.Spec.ClusterIP == apiv1.ClusterIPNone {
+		endpoint.Exposure = exposureHeadless
+	}
+	if len(service.Spec.Ports) > 0 {
+		endpoint.Port = service.Spec.Ports[0].Port
+		endpoint.NodePort = service.Spec.Ports[0].NodePort
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			endpoint.ExternalAddress = ingress.IP
+			break
+		}
+		if ingress.Hostname != "" {
+			endpoint.ExternalAddress = ingress.Hostname
+			break
+		}
+	}
+	return endpoint
+}
@@ -0,0 +1,58 @@
+package kubernetes
+
+import (
+	"schwarz/models"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// GIVEN setExposure and getEndpoint
+func TestExposureEndpoint(t *testing.T) {
+	id := "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b"
+	dnsName := postgresPrefix + id + ".databases.svc"
+	tcs := []struct {
+		description string
+		exposure    string
+		annotations map[string]string
+		status      apiv1.ServiceStatus
+		expected    models.Endpoint
+	}{
+		{
+			description: "WHEN exposure is not set THEN service is only reachable inside the cluster",
+			expected:    models.Endpoint{Exposure: exposureClusterIP, DNSName: dnsName, Port: 5432},
+		},
+		{
+			description: "WHEN exposure is headless THEN service has no cluster IP",
+			exposure:    "Headless",
+			expected:    models.Endpoint{Exposure: exposureHeadless, DNSName: dnsName, Port: 5432},
+		},
+		{
+			description: "WHEN load balancer has no address assigned yet THEN external address is empty",
+			exposure:    "LoadBalancer",
+			annotations: map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"},
+			expected:    models.Endpoint{Exposure: exposureLoadBalancer, DNSName: dnsName, Port: 5432},
+		},
+		{
+			description: "WHEN load balancer has an address assigned THEN external address is set",
+			exposure:    "loadbalancer",
+			status:      apiv1.ServiceStatus{LoadBalancer: apiv1.LoadBalancerStatus{Ingress: []apiv1.LoadBalancerIngress{{Hostname: "db.example.com"}}}},
+			expected:    models.Endpoint{Exposure: exposureLoadBalancer, DNSName: dnsName, Port: 5432, ExternalAddress: "db.example.com"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			service := setService(5432, id)
+			service.Namespace = "databases"
+			setExposure(service, tc.exposure, tc.annotations)
+			service.Status = tc.status
+			if diff := cmp.Diff(tc.expected, getEndpoint(service)); diff != "" {
+				t.Errorf("endpoint has diff %s", diff)
+			}
+			if diff := cmp.Diff(tc.annotations, service.Annotations); diff != "" {
+				t.Errorf("annotations have diff %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package kubernetes
+
+import (
+	"regexp"
+	"schwarz/models"
+	"slices"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const defaultPostgresImage = postgresImageName + ":14"
+
+var (
+	// Versions are tags of the official image, like 16 or 15.4-alpine
+	imageVersionRegexp = regexp.MustCompile(`^[0-9][\w.-]{0,127}$`)
+	// https://github.com/distribution/reference/blob/main/regexp.go, references with optional registry, tag and digest
+	imageReferenceRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::[\w][\w.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+)
+
+// postgresImage returns the reference of a requested image, a bare version being a tag of the official image
+func postgresImage(image string) string {
+	if imageVersionRegexp.MatchString(image) {
+		return postgresImageName + ":" + image
+	}
+	return image
+}
+
+func isValidImage(image string) bool {
+	return imageVersionRegexp.MatchString(image) || imageReferenceRegexp.MatchString(image)
+}
+
+// ImageAllowed tells whether an image, or the version of the official image, is in the allowlist.
+// Every image is allowed when the allowlist is empty.
+func ImageAllowed(image string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	reference := postgresImage(image)
+	return slices.ContainsFunc(allowed, func(entry string) bool { return postgresImage(entry) == reference })
+}
+
+// imageRepository returns the reference of an image without its tag and digest
+func imageRepository(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if separator := strings.LastIndex(image, ":"); separator > strings.LastIndex(image, "/") {
+		return image[:separator]
+	}
+	return image
+}
+
+// updatedImage returns the image an update runs: the requested reference, or the requested tag of
+// the repository running, so custom images keep their registry
+func updatedImage(current string, request models.UpdateRequest, mask sets.Set[string]) string {
+	switch {
+	case mask.Has(updatePathImage):
+		return postgresImage(request.Image)
+	case mask.Has(updatePathImageTag):
+		repository := imageRepository(current)
+		if repository == "" {
+			repository = postgresImageName
+		}
+		return repository + ":" + request.ImageTag
+	default:
+		return current
+	}
+}
+
+// majorVersion returns the major version in the tag of an image, like 16 for postgres:16.2-alpine,
+// empty when the tag doesn't start with a version
+func majorVersion(image string) string {
+	image, _, _ = strings.Cut(postgresImage(image), "@")
+	separator := strings.LastIndex(image, ":")
+	if separator < 0 || separator < strings.LastIndex(image, "/") {
+		return ""
+	}
+	tag := image[separator+1:]
+	end := strings.IndexFunc(tag, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(tag)
+	}
+	return tag[:end]
+}
+
+// image returns the reference of the image requested for an instance, the service default when empty
+func (s *Postgres) image(requested string) string {
+	switch {
+	case requested != "":
+		return postgresImage(requested)
+	case s.config.DefaultImage != "":
+		return postgresImage(s.config.DefaultImage)
+	default:
+		return defaultPostgresImage
+	}
+}
+
+// setImage runs the image in every container of the pod template, the standby init container clones
+// the primary with the same postgres version
+func setImage(template *apiv1.PodTemplateSpec, image string) {
+	for idx := range template.Spec.InitContainers {
+		template.Spec.InitContainers[idx].Image = image
+	}
+	for idx := range template.Spec.Containers {
+		template.Spec.Containers[idx].Image = image
+	}
+}
@@ -0,0 +1,196 @@
+package kubernetes
+
+import (
+	"schwarz/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	instanceKind = "PostgresInstance"
+
+	conditionReconciled = "Reconciled" // Every object of the instance follows the spec
+	conditionReady      = "Ready"      // Every desired replica is ready
+
+	reasonReconciled         = "Reconciled"
+	reasonReconcileFailed    = "ReconcileFailed"
+	reasonCredentialsMissing = "CredentialsMissing"
+	reasonInvalidSpec        = "InvalidSpec"
+	reasonReplicasReady      = "ReplicasReady"
+	reasonProvisioning       = "Provisioning"
+)
+
+// instanceResource is served by the PostgresInstance CustomResourceDefinition of deploy/postgresinstances.yaml
+var instanceResource = schema.GroupVersionResource{Group: "schwarz.io", Version: "v1alpha1", Resource: "postgresinstances"}
+
+// postgresInstance declares an instance, the Controller applies its objects and repairs the missing ones.
+// It is named after the instance id, the credentials are only kept in the instance Secret.
+type postgresInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              instanceSpec   `json:"spec"`
+	Status            instanceStatus `json:"status,omitempty"`
+}
+
+// instanceSpec mirrors models.CreateRequest
+type instanceSpec struct {
+	DBName              string                 `json:"dbName"`
+	UserName            string                 `json:"userName"`
+	PortNum             int32                  `json:"portNum"`
+	Replicas            int32                  `json:"replicas"`
+	Capacity            string                 `json:"capacity"`
+	AccessMode          string                 `json:"accessMode"`
+	Owner               string                 `json:"owner,omitempty"`
+	RequestID           string                 `json:"requestID,omitempty"`
+	Workload            string                 `json:"workload,omitempty"`
+	StorageClass        string                 `json:"storageClass,omitempty"`
+	Exposure            string                 `json:"exposure,omitempty"`
+	ExposureAnnotations map[string]string      `json:"exposureAnnotations,omitempty"`
+	Resources           instanceResources      `json:"resources,omitempty"`
+	Probes              instanceProbes         `json:"probes,omitempty"`
+	AllowedClients      instanceAllowedClients `json:"allowedClients,omitempty"`
+	Scheduling          instanceScheduling     `json:"scheduling,omitempty"`
+	Image               string                 `json:"image,omitempty"`
+}
+
+type instanceResources struct {
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+type instanceProbes struct {
+	PeriodSeconds         int32 `json:"periodSeconds,omitempty"`
+	TimeoutSeconds        int32 `json:"timeoutSeconds,omitempty"`
+	FailureThreshold      int32 `json:"failureThreshold,omitempty"`
+	StartupTimeoutSeconds int32 `json:"startupTimeoutSeconds,omitempty"`
+}
+
+type instanceAllowedClients struct {
+	NamespaceSelectors []string `json:"namespaceSelectors,omitempty"`
+	PodSelectors       []string `json:"podSelectors,omitempty"`
+	CIDRs              []string `json:"cidrs,omitempty"`
+}
+
+type instanceScheduling struct {
+	NodeSelector   map[string]string        `json:"nodeSelector,omitempty"`
+	Tolerations    []instanceToleration     `json:"tolerations,omitempty"`
+	AntiAffinity   instanceAntiAffinity     `json:"antiAffinity,omitempty"`
+	TopologySpread []instanceTopologySpread `json:"topologySpread,omitempty"`
+}
+
+type instanceToleration struct {
+	Key      string `json:"key,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Effect   string `json:"effect,omitempty"`
+}
+
+type instanceAntiAffinity struct {
+	Topology string `json:"topology,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+type instanceTopologySpread struct {
+	Topology          string `json:"topology"`
+	MaxSkew           int32  `json:"maxSkew"`
+	WhenUnsatisfiable string `json:"whenUnsatisfiable,omitempty"`
+}
+
+type instanceStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	ReadyReplicas      int32              `json:"readyReplicas,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+func newPostgresInstance(request models.CreateRequest, id string) *postgresInstance {
+	spec := instanceSpec{
+		DBName:              request.DBName,
+		UserName:            request.UserName,
+		PortNum:             request.PortNum,
+		Replicas:            request.Replicas,
+		Capacity:            request.Capacity,
+		AccessMode:          request.AccessMode,
+		Owner:               request.Owner,
+		RequestID:           request.RequestID,
+		Workload:            request.Workload,
+		StorageClass:        request.StorageClass,
+		Exposure:            request.Exposure,
+		ExposureAnnotations: request.ExposureAnnotations,
+		Resources:           instanceResources(request.Resources),
+		Probes:              instanceProbes(request.Probes),
+		AllowedClients:      instanceAllowedClients(request.AllowedClients),
+		Image:               request.Image,
+		Scheduling: instanceScheduling{
+			NodeSelector: request.Scheduling.NodeSelector,
+			AntiAffinity: instanceAntiAffinity(request.Scheduling.AntiAffinity),
+		},
+	}
+	for _, toleration := range request.Scheduling.Tolerations {
+		spec.Scheduling.Tolerations = append(spec.Scheduling.Tolerations, instanceToleration(toleration))
+	}
+	for _, spread := range request.Scheduling.TopologySpread {
+		spec.Scheduling.TopologySpread = append(spec.Scheduling.TopologySpread, instanceTopologySpread(spread))
+	}
+	return &postgresInstance{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       instanceKind,
+			APIVersion: instanceResource.GroupVersion().String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      id,
+			Namespace: request.Namespace,
+			Labels:    instanceLabels(id, componentDatabase),
+		},
+		Spec: spec,
+	}
+}
+
+// createRequest returns the request the objects of the instance are generated from, without credentials
+func (i *postgresInstance) createRequest() models.CreateRequest {
+	spec := i.Spec
+	request := models.CreateRequest{
+		DBName:              spec.DBName,
+		UserName:            spec.UserName,
+		PortNum:             spec.PortNum,
+		Replicas:            spec.Replicas,
+		Capacity:            spec.Capacity,
+		AccessMode:          spec.AccessMode,
+		Owner:               spec.Owner,
+		RequestID:           spec.RequestID,
+		Workload:            spec.Workload,
+		StorageClass:        spec.StorageClass,
+		Namespace:           i.Namespace,
+		Exposure:            spec.Exposure,
+		ExposureAnnotations: spec.ExposureAnnotations,
+		Resources:           models.Resources(spec.Resources),
+		Probes:              models.Probes(spec.Probes),
+		AllowedClients:      models.AllowedClients(spec.AllowedClients),
+		Image:               spec.Image,
+		Scheduling: models.Scheduling{
+			NodeSelector: spec.Scheduling.NodeSelector,
+			AntiAffinity: models.AntiAffinity(spec.Scheduling.AntiAffinity),
+		},
+	}
+	for _, toleration := range spec.Scheduling.Tolerations {
+		request.Scheduling.Tolerations = append(request.Scheduling.Tolerations, models.Toleration(toleration))
+	}
+	for _, spread := range spec.Scheduling.TopologySpread {
+		request.Scheduling.TopologySpread = append(request.Scheduling.TopologySpread, models.TopologySpread(spread))
+	}
+	return request
+}
+
+func fromUnstructured(object *unstructured.Unstructured) (*postgresInstance, error) {
+	instance := &postgresInstance{}
+	return instance, runtime.DefaultUnstructuredConverter.FromUnstructured(object.UnstructuredContent(), instance)
+}
+
+func toUnstructured(instance *postgresInstance) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+	return &unstructured.Unstructured{Object: content}, err
+}
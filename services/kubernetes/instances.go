@@ -0,0 +1,169 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"schwarz/models"
+	"schwarz/services/prometheus"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Instances serves the API in controller mode: Create writes a PostgresInstance along with the Secret
+// holding its credentials, whose objects are then applied by the Controller. Reads are served from the
+// objects of the instances, like in the imperative mode.
+type Instances struct {
+	*Postgres
+	instances dynamic.NamespaceableResourceInterface
+}
+
+func NewInstances(clientset kubernetes.Interface, dynamicClient dynamic.Interface, metrics *prometheus.Prometheus, config PostgresConfig) Service {
+	return &Instances{
+		Postgres:  NewPostgres(clientset, metrics, config).(*Postgres),
+		instances: dynamicClient.Resource(instanceResource),
+	}
+}
+
+func (s *Instances) Create(ctx context.Context, request models.CreateRequest) (models.CreateResponse, error) {
+	id := instanceID(request)
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+	storageClass, err := s.storageClass(ctx, request.StorageClass)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+		return models.CreateResponse{}, err
+	}
+	namespace, err := s.prepareNamespace(ctx, request, storageClass == hostPathStorageClass)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+		return models.CreateResponse{}, err
+	}
+	request.Namespace = namespace
+	secret := setSecret(request.UserName, request.UserPass, id)
+	if request.RequestID != "" {
+		secret.Annotations = map[string]string{annotationRequestID: request.RequestID, annotationSpecHash: specHash(request)}
+	}
+	replay, err := s.isReplay(ctx, request, secret.Name)
+	if err == nil && !replay {
+		err = apply(ctx, s.kubeClient.CoreV1().Secrets(namespace).Apply, secret)
+	}
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+		return models.CreateResponse{}, fmt.Errorf(createStepError, stepSecret, err)
+	}
+	// The image is pinned so the instance keeps it when the service default changes
+	request.Image = s.image(request.Image)
+	instance, err := toUnstructured(newPostgresInstance(request, id))
+	if err == nil {
+		_, err = s.instances.Namespace(namespace).Create(ctx, instance, metav1.CreateOptions{FieldManager: fieldManager})
+	}
+	if err != nil && !(replay && apierrors.IsAlreadyExists(err)) {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+		return models.CreateResponse{}, fmt.Errorf(createStepError, instanceKind, err)
+	}
+	// The Service is created by the Controller, so the endpoint is empty until it exists and is then
+	// returned by Get. A replayed request may find it already.
+	response := models.CreateResponse{ID: id, Namespace: namespace}
+	service, err := s.kubeClient.CoreV1().Services(namespace).Get(ctx, postgresPrefix+id, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		response.Endpoint = getEndpoint(service)
+	case !apierrors.IsNotFound(err):
+		return models.CreateResponse{}, err
+	}
+	return response, nil
+}
+
+// Update patches the spec of the PostgresInstance, whose objects are then updated by the Controller.
+// Instances created in the imperative mode have none, so their objects are updated right away.
+func (s *Instances) Update(ctx context.Context, request models.UpdateRequest) error {
+	instances := s.instances.Namespace(s.namespace(request.Namespace, ""))
+	object, err := instances.Get(ctx, request.ID, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return s.Postgres.Update(ctx, request)
+	}
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+		return err
+	}
+	instance, err := fromUnstructured(object)
+	if err != nil {
+		return err
+	}
+	// The spec keeps the image pinned on create, so image tags are resolved against it
+	patch, err := json.Marshal(map[string]any{"spec": instanceSpecUpdate(request, instance.Spec.Image)})
+	if err != nil {
+		return err
+	}
+	_, err = instances.Patch(ctx, request.ID, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	}
+	return err
+}
+
+// Delete removes the PostgresInstance first, so the Controller doesn't create its objects again
+func (s *Instances) Delete(ctx context.Context, request models.DeleteRequest) (models.DeleteResponse, error) {
+	deleted := models.DeletedObject{Kind: instanceKind, Name: request.ID, Result: models.DeleteResultDeleted}
+	err := s.instances.Namespace(s.namespace(request.Namespace, "")).Delete(ctx, request.ID, metav1.DeleteOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		deleted.Result = models.DeleteResultNotFound
+	case err != nil:
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "delete"})
+		deleted.Result = models.DeleteResultFailed
+		deleted.Error = err.Error()
+		return models.DeleteResponse{Objects: []models.DeletedObject{deleted}}, fmt.Errorf(deleteObjectError, instanceKind, request.ID, err)
+	}
+	response, err := s.Postgres.Delete(ctx, request)
+	response.Objects = append([]models.DeletedObject{deleted}, response.Objects...)
+	return response, err
+}
+
+// instanceSpecUpdate returns the fields of the spec changed by the update, the image replacing the
+// current one.
+func instanceSpecUpdate(request models.UpdateRequest, current string) map[string]any {
+	mask := sets.New(updatePaths(request)...)
+	spec := map[string]any{}
+	if mask.Has(updatePathReplicas) {
+		spec["replicas"] = request.Replicas
+	}
+	if mask.Has(updatePathPortNum) {
+		spec["portNum"] = request.PortNum
+	}
+	if mask.Has(updatePathCapacity) {
+		spec["capacity"] = request.Capacity
+	}
+	if mask.HasAny(updatePathImage, updatePathImageTag) {
+		spec["image"] = updatedImage(current, request, mask)
+	}
+	resources := map[string]any{}
+	for path, field := range map[string]struct {
+		name  string
+		value string
+	}{
+		updatePathCPURequest:    {"cpuRequest", request.Resources.CPURequest},
+		updatePathCPULimit:      {"cpuLimit", request.Resources.CPULimit},
+		updatePathMemoryRequest: {"memoryRequest", request.Resources.MemoryRequest},
+		updatePathMemoryLimit:   {"memoryLimit", request.Resources.MemoryLimit},
+	} {
+		if mask.HasAny(updatePathResources, path) {
+			// Empty quantities take the service defaults again, a null removes the field
+			var value any
+			if field.value != "" {
+				value = field.value
+			}
+			resources[field.name] = value
+		}
+	}
+	if len(resources) > 0 {
+		spec["resources"] = resources
+	}
+	return spec
+}
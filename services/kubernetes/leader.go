@@ -0,0 +1,72 @@
+package kubernetes
+
+import (
+	"context"
+	"schwarz/services/prometheus"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaderLease         = "schwarz-leader"
+	leaderLeaseDuration = 15 * time.Second
+	leaderRenewDeadline = 10 * time.Second
+	leaderRetryPeriod   = 2 * time.Second
+)
+
+// Leader campaigns for the Lease of the replicas so the background loops run once, the requests are
+// still served by every replica
+type Leader struct {
+	elector *leaderelection.LeaderElector
+}
+
+// NewLeader returns the candidate of a replica, run is called with a context cancelled when the
+// leadership is lost and is called again whenever it is acquired back
+func NewLeader(clientset kubernetes.Interface, metrics *prometheus.Prometheus, namespace, identity string, run func(ctx context.Context)) (*Leader, error) {
+	labels := map[string]string{prometheus.LabelLease: namespace + "/" + leaderLease}
+	_ = metrics.SetGaugeMetric(prometheus.MetricLeader, 0, labels)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: leaderLease, Namespace: namespace},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   leaderLeaseDuration,
+		RenewDeadline:   leaderRenewDeadline,
+		RetryPeriod:     leaderRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaderLease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				_ = metrics.SetGaugeMetric(prometheus.MetricLeader, 1, labels)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				_ = metrics.SetGaugeMetric(prometheus.MetricLeader, 0, labels)
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Leader{elector: elector}, nil
+}
+
+// Run campaigns again each time the leadership is lost until the context is done
+func (l *Leader) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, l.elector.Run, leaderRetryPeriod)
+}
+
+// Details reports whether this replica leads and the leader it last observed, for the readiness endpoint
+func (l *Leader) Details() map[string]string {
+	return map[string]string{
+		"leading": strconv.FormatBool(l.elector.IsLeader()),
+		"leader":  l.elector.GetLeader(),
+	}
+}
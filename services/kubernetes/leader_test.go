@@ -0,0 +1,57 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// GIVEN two replicas campaigning for the Lease
+func TestLeader(t *testing.T) {
+	kubeClient := newFakeClientset()
+	metrics := newTestMetrics(t)
+	started := make(chan string, 2)
+	newLeader := func(identity string) *Leader {
+		leader, err := NewLeader(kubeClient, metrics, metav1.NamespaceDefault, identity, func(context.Context) { started <- identity })
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return leader
+	}
+	first, second := newLeader("first"), newLeader("second")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// WHEN the first replica campaigns alone THEN it leads and runs the background loops
+	go first.Run(ctx)
+	select {
+	case identity := <-started:
+		if identity != "first" {
+			t.Fatalf("expected first to lead, got %s", identity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the background loops to be started")
+	}
+
+	// WHEN the second replica campaigns THEN it follows the first one
+	go second.Run(ctx)
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return second.Details()["leader"] == "first", nil
+	}); err != nil {
+		t.Fatalf("expected second to observe first as leader, got details %v", second.Details())
+	}
+	if details := second.Details(); details["leading"] != "false" {
+		t.Errorf("expected second not to lead, got details %v", details)
+	}
+	if details := first.Details(); details["leading"] != "true" {
+		t.Errorf("expected first to lead, got details %v", details)
+	}
+	select {
+	case identity := <-started:
+		t.Errorf("expected the background loops to run once, started again by %s", identity)
+	default:
+	}
+}
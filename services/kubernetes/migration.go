@@ -0,0 +1,100 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const migrateLabelsError = "relabel instance %s failed: %w"
+
+// MigrateLabels relabels the instances created before per-instance labels were introduced, whose Services
+// select every Postgres pod through app=postgres. Deployment selectors are immutable, so pods get the instance
+// label through the pod template and Services are narrowed to select only their own instance.
+func MigrateLabels(ctx context.Context, kubeClient kubernetes.Interface) error {
+	missingInstance, err := labels.NewRequirement(labelInstance, selection.DoesNotExist, nil)
+	if err != nil {
+		return err
+	}
+	selector := labels.Set{labelApp: labelAppValue}.AsSelector().Add(*missingInstance)
+	deployments, err := kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for idx := range deployments.Items {
+		if err := relabelInstance(ctx, kubeClient, deployments.Items[idx].Name); err != nil {
+			errs = append(errs, fmt.Errorf(migrateLabelsError, deployments.Items[idx].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func relabelInstance(ctx context.Context, kubeClient kubernetes.Interface, id string) error {
+	// Objects missing from old or partially deleted instances are skipped
+	return errors.Join(
+		ignoreNotFound(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			result, err := kubeClient.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Get(ctx, postgresConfigMapPrefix+id, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			result.Labels = labels.Merge(result.Labels, instanceLabels(id, componentConfig))
+			_, err = kubeClient.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Update(ctx, result, metav1.UpdateOptions{})
+			return err
+		})),
+		ignoreNotFound(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			result, err := kubeClient.CoreV1().PersistentVolumes().Get(ctx, postgresVolumePrefix+id, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			result.Labels = labels.Merge(result.Labels, instanceLabels(id, componentStorage))
+			_, err = kubeClient.CoreV1().PersistentVolumes().Update(ctx, result, metav1.UpdateOptions{})
+			return err
+		})),
+		ignoreNotFound(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			result, err := kubeClient.CoreV1().PersistentVolumeClaims(apiv1.NamespaceDefault).Get(ctx, postgresVolumeClaimPrefix+id, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			result.Labels = labels.Merge(result.Labels, instanceLabels(id, componentStorage))
+			_, err = kubeClient.CoreV1().PersistentVolumeClaims(apiv1.NamespaceDefault).Update(ctx, result, metav1.UpdateOptions{})
+			return err
+		})),
+		// Pods must carry the instance label before the Service selects on it
+		ignoreNotFound(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			result, err := kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).Get(ctx, id, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			result.Labels = labels.Merge(result.Labels, instanceLabels(id, componentDatabase))
+			result.Spec.Template.Labels = labels.Merge(result.Spec.Template.Labels, instanceLabels(id, componentDatabase))
+			_, err = kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).Update(ctx, result, metav1.UpdateOptions{})
+			return err
+		})),
+		ignoreNotFound(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			result, err := kubeClient.CoreV1().Services(apiv1.NamespaceDefault).Get(ctx, postgresPrefix+id, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			result.Labels = labels.Merge(result.Labels, instanceLabels(id, componentService))
+			result.Spec.Selector = selectorLabels(id)
+			_, err = kubeClient.CoreV1().Services(apiv1.NamespaceDefault).Update(ctx, result, metav1.UpdateOptions{})
+			return err
+		})),
+	)
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
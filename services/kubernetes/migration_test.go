@@ -0,0 +1,74 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// GIVEN MigrateLabels
+func TestMigrateLabels(t *testing.T) {
+	legacy := map[string]string{"app": "postgres"}
+	objects := func(id string) []runtime.Object {
+		return []runtime.Object{
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: id, Namespace: metav1.NamespaceDefault, Labels: legacy},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: legacy},
+					Template: apiv1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: legacy}},
+				},
+			},
+			&apiv1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: postgresPrefix + id, Namespace: metav1.NamespaceDefault, Labels: legacy},
+				Spec:       apiv1.ServiceSpec{Selector: legacy},
+			},
+			&apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: postgresConfigMapPrefix + id, Namespace: metav1.NamespaceDefault, Labels: legacy}},
+		}
+	}
+	tcs := []struct {
+		description string
+		ids         []string
+	}{
+		{
+			description: "WHEN legacy instances exist THEN Services only select their own instance pods",
+			ids:         []string{"ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b", "0b7d4b1e-6f0b-4a49-9f0e-2d8a3c2f6f11"},
+		},
+		{
+			description: "WHEN there are no legacy instances THEN nothing is done",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			var initial []runtime.Object
+			for _, id := range tc.ids {
+				initial = append(initial, objects(id)...)
+			}
+			kubeClient := fake.NewSimpleClientset(initial...)
+			if err := MigrateLabels(context.Background(), kubeClient); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			for _, id := range tc.ids {
+				service, err := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Get(context.Background(), postgresPrefix+id, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if diff := cmp.Diff(selectorLabels(id), service.Spec.Selector); diff != "" {
+					t.Errorf("service selector has diff %s", diff)
+				}
+				deployment, err := kubeClient.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.Background(), id, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if diff := cmp.Diff(instanceLabels(id, componentDatabase), deployment.Spec.Template.Labels); diff != "" {
+					t.Errorf("pod template labels have diff %s", diff)
+				}
+			}
+		})
+	}
+}
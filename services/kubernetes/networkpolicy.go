@@ -0,0 +1,103 @@
+package kubernetes
+
+import (
+	"context"
+	"schwarz/models"
+	"schwarz/services/prometheus"
+
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	networkingv1ac "k8s.io/client-go/applyconfigurations/networking/v1"
+)
+
+const (
+	postgresNetworkPolicyPrefix = "postgres-netpol-"
+	stepNetworkPolicy           = "networkpolicy"
+)
+
+// setNetworkPolicy only admits connections to the postgres port from the allowed clients. Without
+// any, clients of the instance namespace are allowed. The pods of the instance always reach each
+// other, so standbys can stream from the primary.
+func setNetworkPolicy(port int32, allowedClients models.AllowedClients, id string) *networkingv1.NetworkPolicy {
+	peers := []networkingv1.NetworkPolicyPeer{{
+		PodSelector: &metav1.LabelSelector{MatchLabels: selectorLabels(id)},
+	}}
+	// Selectors are validated on the request
+	for _, selector := range allowedClients.NamespaceSelectors {
+		namespaceSelector, _ := metav1.ParseToLabelSelector(selector)
+		peers = append(peers, networkingv1.NetworkPolicyPeer{NamespaceSelector: namespaceSelector})
+	}
+	for _, selector := range allowedClients.PodSelectors {
+		podSelector, _ := metav1.ParseToLabelSelector(selector)
+		peers = append(peers, networkingv1.NetworkPolicyPeer{PodSelector: podSelector})
+	}
+	for _, cidr := range allowedClients.CIDRs {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	if len(peers) == 1 {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{}})
+	}
+	protocol := apiv1.ProtocolTCP
+	postgresPort := intstr.FromInt32(port)
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   postgresNetworkPolicyPrefix + id,
+			Labels: instanceLabels(id, componentConfig),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selectorLabels(id)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{{
+					Protocol: &protocol,
+					Port:     &postgresPort,
+				}},
+				From: peers,
+			}},
+		},
+	}
+}
+
+// updateNetworkPolicy moves the allowed port along with the Services. Instances created before
+// network policies have none.
+func (s *Postgres) updateNetworkPolicy(ctx context.Context, request models.UpdateRequest) error {
+	result, err := getManaged(ctx, s.kubeClient.NetworkingV1().NetworkPolicies(request.Namespace), nil, postgresNetworkPolicyPrefix+request.ID)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+		return err
+	}
+	config, err := networkingv1ac.ExtractNetworkPolicy(result, fieldManager)
+	if err != nil {
+		return err
+	}
+	// Ingress rules are atomic, so the whole list is applied again with the port replaced
+	spec, err := applyConfiguration[networkingv1ac.NetworkPolicySpecApplyConfiguration](result.Spec)
+	if err != nil {
+		return err
+	}
+	for _, rule := range spec.Ingress {
+		for idx := range rule.Ports {
+			// Ports share the backing array of the policy
+			rule.Ports[idx].WithPort(intstr.FromInt32(request.PortNum))
+		}
+	}
+	if config.Spec == nil {
+		config.WithSpec(networkingv1ac.NetworkPolicySpec())
+	}
+	config.Spec.Ingress = spec.Ingress
+	_, err = s.kubeClient.NetworkingV1().NetworkPolicies(request.Namespace).Apply(ctx, config, applyOptions)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"schwarz/models"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	stepOwnerReferences = "ownerreferences"
+
+	adoptObjectError  = "adopt %s %s failed: %w"
+	deleteObjectError = "delete %s %s failed: %w"
+)
+
+// instanceObject is one of the objects making up an instance
+type instanceObject struct {
+	kind   string
+	name   string
+	patch  func(ctx context.Context, data []byte) error
+	delete func(ctx context.Context) error
+}
+
+// objectClient is implemented by the typed clients of every kind of object
+type objectClient[T any] interface {
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+}
+
+func newInstanceObject[T any](client objectClient[T], kind, name string, options metav1.DeleteOptions) instanceObject {
+	return instanceObject{
+		kind: kind,
+		name: name,
+		patch: func(ctx context.Context, data []byte) error {
+			_, err := client.Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: fieldManager})
+			return err
+		},
+		delete: func(ctx context.Context) error {
+			return client.Delete(ctx, name, options)
+		},
+	}
+}
+
+// ownedObjects returns the namespaced objects of an instance besides its workload, of both workloads
+// when the kind is unknown. They are owned by the workload, but in controller mode the Secret is owned
+// by the PostgresInstance, so it outlives a workload deleted by hand. Claims of a StatefulSet are owned
+// through its retention policy, volumes are cluster scoped so they can't be owned.
+func (s *Postgres) ownedObjects(namespace, id, kind string) []instanceObject {
+	core := s.kubeClient.CoreV1()
+	services := []string{postgresPrefix + id}
+	configMaps := []string{postgresConfigMapPrefix + id}
+	if kind != workloadDeployment {
+		services = append(services, postgresHeadlessPrefix+id, postgresReadOnlyPrefix+id)
+		configMaps = append(configMaps, postgresReplicationPrefix+id)
+	}
+	var objects []instanceObject
+	for _, name := range services {
+		objects = append(objects, newInstanceObject[*apiv1.Service](core.Services(namespace), "Service", name, metav1.DeleteOptions{}))
+	}
+	objects = append(objects,
+		newInstanceObject[*networkingv1.NetworkPolicy](s.kubeClient.NetworkingV1().NetworkPolicies(namespace), "NetworkPolicy", postgresNetworkPolicyPrefix+id, metav1.DeleteOptions{}),
+		newInstanceObject[*policyv1.PodDisruptionBudget](s.kubeClient.PolicyV1().PodDisruptionBudgets(namespace), "PodDisruptionBudget", postgresDisruptionBudgetPrefix+id, metav1.DeleteOptions{}),
+	)
+	if kind != workloadStatefulSet {
+		objects = append(objects, newInstanceObject[*apiv1.PersistentVolumeClaim](core.PersistentVolumeClaims(namespace), "PersistentVolumeClaim", postgresVolumeClaimPrefix+id, metav1.DeleteOptions{}))
+	}
+	for _, name := range configMaps {
+		objects = append(objects, newInstanceObject[*apiv1.ConfigMap](core.ConfigMaps(namespace), "ConfigMap", name, metav1.DeleteOptions{}))
+	}
+	return append(objects, newInstanceObject[*apiv1.Secret](core.Secrets(namespace), "Secret", postgresCredentialsPrefix+id, metav1.DeleteOptions{}))
+}
+
+// adoptObjects makes the workload the owner of the other objects of a new instance, so the garbage
+// collector deletes them along with it.
+func (s *Postgres) adoptObjects(ctx context.Context, namespace, id string) error {
+	workload, err := s.getWorkload(ctx, namespace, id)
+	if err != nil {
+		return err
+	}
+	blockOwnerDeletion := true
+	ownerReference := metav1.OwnerReference{
+		APIVersion:         appsv1.SchemeGroupVersion.String(),
+		Kind:               "StatefulSet",
+		Name:               workload.name,
+		UID:                workload.uid,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}
+	if workload.kind == workloadDeployment {
+		ownerReference.Kind = "Deployment"
+	}
+	return setOwner(ctx, s.ownedObjects(namespace, id, workload.kind), ownerReference)
+}
+
+// setOwner makes the owner reference the only one of the objects
+func setOwner(ctx context.Context, objects []instanceObject, ownerReference metav1.OwnerReference) error {
+	data, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"ownerReferences": []metav1.OwnerReference{ownerReference}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := object.patch(ctx, data); err != nil {
+			return fmt.Errorf(adoptObjectError, object.kind, object.name, err)
+		}
+	}
+	return nil
+}
+
+// deleteObjects deletes every object of an instance, going on when one fails so a retry only has the
+// failed ones left. Objects already gone count as deleted.
+func (s *Postgres) deleteObjects(ctx context.Context, namespace, id, kind string) (models.DeleteResponse, error) {
+	deletePolicy := metav1.DeletePropagationForeground
+	workloadOptions := metav1.DeleteOptions{PropagationPolicy: &deletePolicy}
+	var objects []instanceObject
+	if kind != workloadDeployment {
+		objects = append(objects, newInstanceObject[*appsv1.StatefulSet](s.kubeClient.AppsV1().StatefulSets(namespace), "StatefulSet", id, workloadOptions))
+	}
+	if kind != workloadStatefulSet {
+		objects = append(objects, newInstanceObject[*appsv1.Deployment](s.kubeClient.AppsV1().Deployments(namespace), "Deployment", id, workloadOptions))
+	}
+	objects = append(objects, s.ownedObjects(namespace, id, kind)...)
+	var errs []error
+	// Claims of the StatefulSet replicas and the volumes of dev mode are only known by their labels
+	storageSelector := metav1.ListOptions{LabelSelector: labels.Set(instanceLabels(id, componentStorage)).String()}
+	if claims, err := s.kubeClient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, storageSelector); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, claim := range claims.Items {
+			if claim.Name != postgresVolumeClaimPrefix+id {
+				objects = append(objects, newInstanceObject[*apiv1.PersistentVolumeClaim](s.kubeClient.CoreV1().PersistentVolumeClaims(namespace), "PersistentVolumeClaim", claim.Name, metav1.DeleteOptions{}))
+			}
+		}
+	}
+	if volumes, err := s.kubeClient.CoreV1().PersistentVolumes().List(ctx, storageSelector); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, volume := range volumes.Items {
+			objects = append(objects, newInstanceObject[*apiv1.PersistentVolume](s.kubeClient.CoreV1().PersistentVolumes(), "PersistentVolume", volume.Name, metav1.DeleteOptions{}))
+		}
+	}
+	var response models.DeleteResponse
+	for _, object := range objects {
+		deleted := models.DeletedObject{Kind: object.kind, Name: object.name, Result: models.DeleteResultDeleted}
+		if err := object.delete(ctx); apierrors.IsNotFound(err) {
+			deleted.Result = models.DeleteResultNotFound
+		} else if err != nil {
+			deleted.Result = models.DeleteResultFailed
+			deleted.Error = err.Error()
+			errs = append(errs, fmt.Errorf(deleteObjectError, object.kind, object.name, err))
+		}
+		response.Objects = append(response.Objects, deleted)
+	}
+	return response, errors.Join(errs...)
+}
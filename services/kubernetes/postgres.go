@@ -2,111 +2,1303 @@ package kubernetes
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"schwarz/models"
 	"schwarz/services/prometheus"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
 )
 
 const (
 	postgresPrefix            = "postgres-"
 	postgresVolumePrefix      = "postgres-volume-"
 	postgresVolumeClaimPrefix = "postgres-volume-claim-"
-	postgresSecretPrefix      = "postgres-secret-"
+	postgresConfigMapPrefix   = "postgres-secret-" // kept from when credentials lived in the ConfigMap
+	postgresCredentialsPrefix = "postgres-credentials-"
+	postgresHeadlessPrefix    = "postgres-headless-"
+	postgresDataVolume        = "postgresdata"
+
+	envPostgresDB       = "POSTGRES_DB"
+	envPostgresUser     = "POSTGRES_USER"
+	envPostgresPassword = "POSTGRES_PASSWORD"
+
+	labelApp      = "app"
+	labelAppValue = "postgres"
+	labelOwner    = "owner"
+	labelInstance = "app.kubernetes.io/instance"
+
+	labelManagedBy      = "app.kubernetes.io/managed-by"
+	labelManagedByValue = "schwarz"
+	labelComponent      = "app.kubernetes.io/component"
+	componentDatabase   = "database"
+	componentStorage    = "storage"
+	componentConfig     = "config"
+	componentService    = "service"
+
+	defaultPageSize = 50
+
+	postgresImageName   = "postgres"
+	annotationRequestID = "schwarz/request-id"
+	annotationSpecHash  = "schwarz/spec-hash"
+
+	requestIDConflictError = "request_id %s already used with a different spec"
+	invalidPageTokenError  = "invalid page_token %s"
+	namespaceNotOwnedError = "namespace %s does not belong to owner %s"
+	ownerRequiredError     = "owner is required with tenant namespaces"
+	createStepError        = "create %s failed: %w"
+	rollbackStepError      = "rollback %s failed: %w"
+
+	stepSecret                = "secret"
+	stepConfigMap             = "configmap"
+	stepPersistentVolume      = "persistentvolume"
+	stepPersistentVolumeClaim = "persistentvolumeclaim"
+	stepDeployment            = "deployment"
+	stepService               = "service"
+	stepStatefulSet           = "statefulset"
+	stepHeadlessService       = "headlessservice"
+	stepReadOnlyService       = "readonlyservice"
+	stepReplicationConfigMap  = "replicationconfigmap"
+
+	rollbackTimeout = 30 * time.Second
+
+	updatePathReplicas = "replicas"
+	updatePathPortNum  = "port_num"
+	updatePathUserName = "user_name"
+	updatePathUserPass = "user_pass"
+	updatePathCapacity = "capacity"
+	updatePathImageTag = "image_tag"
+	updatePathImage    = "image"
 )
 
+// Namespace used to derive instance ids from client request IDs
+var requestIDNamespace = uuid.MustParse("5d3f0b5e-8a4c-4c1e-9a51-2f6b7e0c9d13")
+
+// createStep creates one of the objects of an instance, along with the compensation which deletes it
+type createStep struct {
+	name   string
+	get    func(ctx context.Context) error // Reads the object, NotFound when missing. Always created again when nil
+	create func() error
+	delete func(ctx context.Context) error
+}
+
+// exists tells whether the object of the step was there before it is created
+func (c createStep) exists(ctx context.Context) (bool, error) {
+	if c.get == nil {
+		return false, nil
+	}
+	err := c.get(ctx)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// getter reads a generated object with the Get of its typed client
+func getter[T any](get func(context.Context, string, metav1.GetOptions) (T, error), name string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := get(ctx, name, metav1.GetOptions{})
+		return err
+	}
+}
+
+// PostgresConfig holds the service-level settings applied to every instance
+type PostgresConfig struct {
+	HostPathStorage  bool             // Dev mode, instances without storage class get hostPath volumes instead of the default class
+	DefaultNamespace string           // Namespace of requests without one, default when empty
+	TenantNamespaces bool             // Instances of each owner go to their own namespace, created on demand
+	DefaultResources models.Resources // Resources of the pods whose request leaves them empty
+	// Minimum Pod Security level, privileged, baseline or restricted, the target namespace must enforce. None when empty
+	MinPodSecurityLevel string
+	Cache               *Cache // Serves the reads once synced, reads go to the apiserver when nil
+	DefaultImage        string // Image, or version of the official image, of requests without one. postgres:14 when empty
+}
+
 type Postgres struct {
-	kubeClient *kubernetes.Clientset
+	kubeClient kubernetes.Interface
 	metrics    *prometheus.Prometheus
+	config     PostgresConfig
 }
 
-func NewPostgres(clientset *kubernetes.Clientset, metrics *prometheus.Prometheus) Service {
+func NewPostgres(clientset kubernetes.Interface, metrics *prometheus.Prometheus, config PostgresConfig) Service {
 	return &Postgres{
 		kubeClient: clientset,
 		metrics:    metrics,
+		config:     config,
 	}
 }
 
 func (s *Postgres) Create(ctx context.Context, request models.CreateRequest) (models.CreateResponse, error) {
-	id := uuid.New().String()
+	id := instanceID(request)
 	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
-	configMap := setConfigMap(request.DBName, request.UserName, request.UserPass, id)
-	persistentVolume := setPersistentVolume(request.Capacity, []string{request.AccessMode}, id)
-	persistentVolumeClaim := setPersistentVolumeClaim(request.Capacity, []string{request.AccessMode}, id)
-	deployment := setDeployment(request.Replicas, request.PortNum, id)
-	service := setService(request.PortNum, id)
-	if _, err := s.kubeClient.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
-		return models.CreateResponse{}, err
-	} else if _, err := s.kubeClient.CoreV1().PersistentVolumes().Create(ctx, persistentVolume, metav1.CreateOptions{}); err != nil {
-		return models.CreateResponse{}, err
-	} else if _, err := s.kubeClient.CoreV1().PersistentVolumeClaims(apiv1.NamespaceDefault).Create(ctx, persistentVolumeClaim, metav1.CreateOptions{}); err != nil {
+	storageClass, err := s.storageClass(ctx, request.StorageClass)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
 		return models.CreateResponse{}, err
-	} else if _, err = s.kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).Create(ctx, deployment, metav1.CreateOptions{}); err != nil {
+	}
+	namespace, err := s.prepareNamespace(ctx, request, storageClass == hostPathStorageClass)
+	if err != nil {
 		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
 		return models.CreateResponse{}, err
-	} else if _, err := s.kubeClient.CoreV1().Services(apiv1.NamespaceDefault).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+	}
+	request.Namespace = namespace
+	// Objects of a replayed request belong to the instance of the previous attempt, so they are never rolled back
+	replay := false
+	if request.RequestID != "" {
+		if replay, err = s.isReplay(ctx, request, postgresCredentialsPrefix+id); err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+			return models.CreateResponse{}, fmt.Errorf(createStepError, stepSecret, err)
+		}
+	}
+	// Only the objects this call created are rolled back, those found existing are left as they are.
+	// A replay only creates the objects its previous attempt left missing, the others may have been
+	// updated since and applying the original spec again would revert them.
+	var done []createStep
+	for _, step := range s.createSteps(ctx, request, storageClass, id) {
+		existed, err := step.exists(ctx)
+		if err == nil && !(replay && existed) {
+			err = step.create()
+		}
+		if err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "create"})
+			err = fmt.Errorf(createStepError, step.name, err)
+			if !replay && len(done) > 0 {
+				_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentRollbackTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelStep: step.name})
+				err = errors.Join(err, s.rollback(ctx, done))
+			}
+			return models.CreateResponse{}, err
+		}
+		if !existed {
+			done = append(done, step)
+		}
+	}
+	// Node ports are assigned by the apiserver, so the endpoint is read back from the created Service
+	created, err := s.kubeClient.CoreV1().Services(request.Namespace).Get(ctx, postgresPrefix+id, metav1.GetOptions{})
+	if err != nil {
 		return models.CreateResponse{}, err
 	}
-	return models.CreateResponse{ID: id}, nil
+	return models.CreateResponse{ID: id, Namespace: request.Namespace, Endpoint: getEndpoint(created)}, nil
+}
+
+// prepareNamespace resolves the namespace of a new instance, creating the namespace of the owner in
+// tenant mode, and checks it admits the pods.
+func (s *Postgres) prepareNamespace(ctx context.Context, request models.CreateRequest, hostPath bool) (string, error) {
+	namespace := s.namespace(request.Namespace, request.Owner)
+	if s.config.TenantNamespaces {
+		// Instances without owner could go to any namespace, including the ones of tenants
+		if request.Owner == "" {
+			return "", fmt.Errorf(ownerRequiredError)
+		}
+		if namespace != tenantNamespace(request.Owner) {
+			return "", fmt.Errorf(namespaceNotOwnedError, namespace, request.Owner)
+		}
+		if err := s.ensureTenantNamespace(ctx, namespace, request.Owner); err != nil {
+			return "", err
+		}
+	}
+	return namespace, s.checkPodSecurity(ctx, namespace, hostPath)
+}
+
+// createSteps generates the objects of an instance, in the order they are created
+func (s *Postgres) createSteps(ctx context.Context, request models.CreateRequest, storageClass, id string) []createStep {
+	secret := setSecret(request.UserName, request.UserPass, id)
+	configMap := setConfigMap(request.DBName, id)
+	networkPolicy := setNetworkPolicy(request.PortNum, request.AllowedClients, id)
+	podDisruptionBudget := setPodDisruptionBudget(request.Replicas, id)
+	service := setService(request.PortNum, id)
+	setExposure(service, request.Exposure, request.ExposureAnnotations)
+	if request.RequestID != "" {
+		for _, object := range []metav1.Object{secret, configMap, networkPolicy, podDisruptionBudget, service} {
+			object.SetAnnotations(map[string]string{annotationRequestID: request.RequestID})
+		}
+		// The spec hash covers the credentials, so it is only kept on the Secret
+		secret.Annotations[annotationSpecHash] = specHash(request)
+	}
+	steps := []createStep{
+		{
+			name: stepSecret,
+			get:  getter(s.kubeClient.CoreV1().Secrets(request.Namespace).Get, secret.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().Secrets(request.Namespace).Apply, secret)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().Secrets(request.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			name: stepConfigMap,
+			get:  getter(s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Get, configMap.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Apply, configMap)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+			},
+		},
+		// Created before the pods, so they are never reachable by other clients
+		{
+			name: stepNetworkPolicy,
+			get:  getter(s.kubeClient.NetworkingV1().NetworkPolicies(request.Namespace).Get, networkPolicy.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.NetworkingV1().NetworkPolicies(request.Namespace).Apply, networkPolicy)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.NetworkingV1().NetworkPolicies(request.Namespace).Delete(ctx, networkPolicy.Name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			name: stepPodDisruptionBudget,
+			get:  getter(s.kubeClient.PolicyV1().PodDisruptionBudgets(request.Namespace).Get, podDisruptionBudget.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.PolicyV1().PodDisruptionBudgets(request.Namespace).Apply, podDisruptionBudget)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.PolicyV1().PodDisruptionBudgets(request.Namespace).Delete(ctx, podDisruptionBudget.Name, metav1.DeleteOptions{})
+			},
+		},
+	}
+	if strings.EqualFold(request.Workload, workloadDeployment) {
+		steps = append(steps, s.deploymentSteps(ctx, request, storageClass, id)...)
+	} else {
+		// Writes only go to the primary, reads to the hot standbys go through the read-only Service
+		setPrimaryService(service, id)
+		steps = append(steps, s.statefulSetSteps(ctx, request, storageClass, id)...)
+	}
+	steps = append(steps, createStep{
+		name: stepService,
+		get:  getter(s.kubeClient.CoreV1().Services(request.Namespace).Get, service.Name),
+		create: func() error {
+			return apply(ctx, s.kubeClient.CoreV1().Services(request.Namespace).Apply, service)
+		},
+		delete: func(ctx context.Context) error {
+			return s.kubeClient.CoreV1().Services(request.Namespace).Delete(ctx, service.Name, metav1.DeleteOptions{})
+		},
+	})
+	// Created last, once the workload the other objects are owned by exists
+	steps = append(steps, createStep{
+		name: stepOwnerReferences,
+		create: func() error {
+			return s.adoptObjects(ctx, request.Namespace, id)
+		},
+		delete: func(context.Context) error {
+			return nil
+		},
+	})
+	return steps
+}
+
+// rollback deletes, in reverse order, the objects created by the steps already done. It keeps running when the
+// request context is cancelled, so a client timeout does not leave orphaned objects behind.
+func (s *Postgres) rollback(ctx context.Context, done []createStep) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	var errs []error
+	for idx := len(done) - 1; idx >= 0; idx-- {
+		if err := done[idx].delete(ctx); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf(rollbackStepError, done[idx].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deploymentSteps creates a single claim shared by all the replicas of a Deployment
+func (s *Postgres) deploymentSteps(ctx context.Context, request models.CreateRequest, storageClass, id string) []createStep {
+	persistentVolume := setPersistentVolume(request.Capacity, []string{request.AccessMode}, id)
+	persistentVolumeClaim := setPersistentVolumeClaim(request.Capacity, []string{request.AccessMode}, storageClass, id)
+	deployment := setDeployment(request.Replicas, request.PortNum, id, request.Owner)
+	setResources(&deployment.Spec.Template, withDefaultResources(request.Resources, s.config.DefaultResources))
+	setProbes(&deployment.Spec.Template, request.Probes)
+	setPodSecurity(&deployment.Spec.Template, storageClass == hostPathStorageClass)
+	setScheduling(&deployment.Spec.Template, request.Scheduling, id)
+	setImage(&deployment.Spec.Template, s.image(request.Image))
+	if request.RequestID != "" {
+		for _, object := range []metav1.Object{persistentVolume, persistentVolumeClaim, deployment} {
+			object.SetAnnotations(map[string]string{annotationRequestID: request.RequestID})
+		}
+	}
+	var steps []createStep
+	// Volumes of any other class are bound by its provisioner
+	if isHostPath(persistentVolumeClaim) {
+		steps = append(steps, createStep{
+			name: stepPersistentVolume,
+			get:  getter(s.kubeClient.CoreV1().PersistentVolumes().Get, persistentVolume.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().PersistentVolumes().Apply, persistentVolume)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().PersistentVolumes().Delete(ctx, persistentVolume.Name, metav1.DeleteOptions{})
+			},
+		})
+	}
+	return append(steps,
+		createStep{
+			name: stepPersistentVolumeClaim,
+			get:  getter(s.kubeClient.CoreV1().PersistentVolumeClaims(request.Namespace).Get, persistentVolumeClaim.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().PersistentVolumeClaims(request.Namespace).Apply, persistentVolumeClaim)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().PersistentVolumeClaims(request.Namespace).Delete(ctx, persistentVolumeClaim.Name, metav1.DeleteOptions{})
+			},
+		},
+		createStep{
+			name: stepDeployment,
+			get:  getter(s.kubeClient.AppsV1().Deployments(request.Namespace).Get, deployment.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.AppsV1().Deployments(request.Namespace).Apply, deployment)
+			},
+			delete: func(ctx context.Context) error {
+				deletePolicy := metav1.DeletePropagationForeground
+				return s.kubeClient.AppsV1().Deployments(request.Namespace).Delete(ctx, deployment.Name, metav1.DeleteOptions{
+					PropagationPolicy: &deletePolicy,
+				})
+			},
+		},
+	)
+}
+
+// statefulSetSteps creates a claim per replica through the StatefulSet volumeClaimTemplates, along
+// with their volumes in dev mode.
+func (s *Postgres) statefulSetSteps(ctx context.Context, request models.CreateRequest, storageClass, id string) []createStep {
+	replicationConfigMap := setReplicationConfigMap(id)
+	headlessService := setHeadlessService(request.PortNum, id)
+	readOnlyService := setReadOnlyService(request.PortNum, id)
+	setExposure(readOnlyService, request.Exposure, request.ExposureAnnotations)
+	statefulSet := setStatefulSet(request.Replicas, request.PortNum, request.Capacity, []string{request.AccessMode}, storageClass, id, request.Owner)
+	setResources(&statefulSet.Spec.Template, withDefaultResources(request.Resources, s.config.DefaultResources))
+	setProbes(&statefulSet.Spec.Template, request.Probes)
+	setPodSecurity(&statefulSet.Spec.Template, isHostPath(&statefulSet.Spec.VolumeClaimTemplates[0]))
+	setScheduling(&statefulSet.Spec.Template, request.Scheduling, id)
+	setImage(&statefulSet.Spec.Template, s.image(request.Image))
+	var persistentVolumes []*apiv1.PersistentVolume
+	if isHostPath(&statefulSet.Spec.VolumeClaimTemplates[0]) {
+		for ordinal := int32(0); ordinal < request.Replicas; ordinal++ {
+			persistentVolumes = append(persistentVolumes, setReplicaPersistentVolume(request.Capacity, []string{request.AccessMode}, request.Namespace, id, ordinal))
+		}
+	}
+	if request.RequestID != "" {
+		objects := []metav1.Object{replicationConfigMap, headlessService, readOnlyService, statefulSet}
+		for _, persistentVolume := range persistentVolumes {
+			objects = append(objects, persistentVolume)
+		}
+		for _, object := range objects {
+			object.SetAnnotations(map[string]string{annotationRequestID: request.RequestID})
+		}
+	}
+	steps := make([]createStep, 0, len(persistentVolumes)+4)
+	for _, persistentVolume := range persistentVolumes {
+		steps = append(steps, createStep{
+			name: stepPersistentVolume,
+			get:  getter(s.kubeClient.CoreV1().PersistentVolumes().Get, persistentVolume.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().PersistentVolumes().Apply, persistentVolume)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().PersistentVolumes().Delete(ctx, persistentVolume.Name, metav1.DeleteOptions{})
+			},
+		})
+	}
+	return append(steps,
+		createStep{
+			name: stepReplicationConfigMap,
+			get:  getter(s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Get, replicationConfigMap.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Apply, replicationConfigMap)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Delete(ctx, replicationConfigMap.Name, metav1.DeleteOptions{})
+			},
+		},
+		createStep{
+			name: stepHeadlessService,
+			get:  getter(s.kubeClient.CoreV1().Services(request.Namespace).Get, headlessService.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().Services(request.Namespace).Apply, headlessService)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().Services(request.Namespace).Delete(ctx, headlessService.Name, metav1.DeleteOptions{})
+			},
+		},
+		createStep{
+			name: stepStatefulSet,
+			get:  getter(s.kubeClient.AppsV1().StatefulSets(request.Namespace).Get, statefulSet.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.AppsV1().StatefulSets(request.Namespace).Apply, statefulSet)
+			},
+			delete: func(ctx context.Context) error {
+				deletePolicy := metav1.DeletePropagationForeground
+				if err := s.kubeClient.AppsV1().StatefulSets(request.Namespace).Delete(ctx, statefulSet.Name, metav1.DeleteOptions{
+					PropagationPolicy: &deletePolicy,
+				}); err != nil {
+					return err
+				}
+				// Claims created from the templates are retained by the StatefulSet controller
+				return s.deleteClaims(ctx, request.Namespace, id)
+			},
+		},
+		createStep{
+			name: stepReadOnlyService,
+			get:  getter(s.kubeClient.CoreV1().Services(request.Namespace).Get, readOnlyService.Name),
+			create: func() error {
+				return apply(ctx, s.kubeClient.CoreV1().Services(request.Namespace).Apply, readOnlyService)
+			},
+			delete: func(ctx context.Context) error {
+				return s.kubeClient.CoreV1().Services(request.Namespace).Delete(ctx, readOnlyService.Name, metav1.DeleteOptions{})
+			},
+		},
+	)
+}
+
+// isReplay checks whether the Secret was already created by a previous attempt of the same request,
+// returning a conflict error when the request ID was used with a different spec. Replays return the
+// instance as it is, only creating what the previous attempt left missing.
+func (s *Postgres) isReplay(ctx context.Context, request models.CreateRequest, name string) (bool, error) {
+	existing, err := s.kubeClient.CoreV1().Secrets(request.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if request.RequestID == "" {
+		return false, apierrors.NewAlreadyExists(apiv1.Resource("secrets"), name)
+	}
+	if existing.Annotations[annotationSpecHash] != specHash(request) {
+		return false, fmt.Errorf(requestIDConflictError, request.RequestID)
+	}
+	return true, nil
+}
+
+func (s *Postgres) Get(ctx context.Context, request models.GetRequest) (models.GetResponse, error) {
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+	request.Namespace = s.namespace(request.Namespace, "")
+	workload, err := s.getWorkload(ctx, request.Namespace, request.ID)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+		return models.GetResponse{}, err
+	}
+	service, err := readThrough(ctx, s.config.Cache.service(request.Namespace), s.kubeClient.CoreV1().Services(request.Namespace).Get, postgresPrefix+request.ID)
+	if err != nil {
+		return models.GetResponse{}, err
+	}
+	claims, err := s.listClaims(ctx, request.Namespace, instanceLabels(request.ID, componentStorage))
+	if err != nil {
+		return models.GetResponse{}, err
+	}
+	// Claims of a StatefulSet are only created once its pods are scheduled
+	var persistentVolumeClaim *apiv1.PersistentVolumeClaim
+	switch {
+	case len(claims) > 0:
+		persistentVolumeClaim = &claims[0]
+	case len(workload.claimTemplates) > 0:
+		persistentVolumeClaim = &workload.claimTemplates[0]
+	default:
+		return models.GetResponse{}, apierrors.NewNotFound(apiv1.Resource("persistentvolumeclaims"), postgresVolumeClaimPrefix+request.ID)
+	}
+	configMap, err := readThrough(ctx, s.config.Cache.configMap(request.Namespace), s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Get, postgresConfigMapPrefix+request.ID)
+	if err != nil {
+		return models.GetResponse{}, err
+	}
+	pods, err := s.listPods(ctx, request.Namespace, selectorLabels(request.ID))
+	if err != nil {
+		return models.GetResponse{}, err
+	}
+	response := getResponse(request.ID, workload, service, persistentVolumeClaim, configMap)
+	for idx := range pods {
+		response.Pods = append(response.Pods, getPodStatus(workload, &pods[idx]))
+	}
+	if workload.kind == workloadStatefulSet {
+		readOnlyService, err := readThrough(ctx, s.config.Cache.service(request.Namespace), s.kubeClient.CoreV1().Services(request.Namespace).Get, postgresReadOnlyPrefix+request.ID)
+		if err != nil {
+			return models.GetResponse{}, err
+		}
+		if len(readOnlyService.Spec.Ports) > 0 {
+			response.ReadOnlyNodePort = readOnlyService.Spec.Ports[0].NodePort
+		}
+		response.ReadOnlyEndpoint = getEndpoint(readOnlyService)
+	}
+	return response, nil
 }
 
-func (s *Postgres) Delete(ctx context.Context, request models.DeleteRequest) error {
+func (s *Postgres) List(ctx context.Context, request models.ListRequest) (models.ListResponse, error) {
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: "", prometheus.LabelOperation: "list"})
+	request.Namespace = s.namespace(request.Namespace, request.Owner)
+	set := labels.Set{labelManagedBy: labelManagedByValue, labelComponent: componentDatabase}
+	if request.Owner != "" {
+		set[labelOwner] = request.Owner
+	}
+	selector := set.AsSelector()
+	if request.LabelSelector != "" {
+		requested, err := labels.Parse(request.LabelSelector)
+		if err != nil {
+			return models.ListResponse{}, err
+		}
+		requirements, _ := requested.Requirements()
+		selector = selector.Add(requirements...)
+	}
+	pageSize := request.PageSize
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	// StatefulSets are paged first, then the Deployments of older instances
+	token := pageToken{Kind: workloadStatefulSet}
+	if request.PageToken != "" {
+		var err error
+		if token, err = decodePageToken(request.PageToken); err != nil {
+			return models.ListResponse{}, err
+		}
+	}
+	response := models.ListResponse{Instances: []models.InstanceSummary{}}
+	if token.Kind == workloadStatefulSet {
+		statefulSets, next, err := s.listWorkloads(ctx, request.Namespace, selector, pageSize, token)
+		if err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: "", prometheus.LabelOperation: "list"})
+			return models.ListResponse{}, err
+		}
+		for _, statefulSet := range statefulSets {
+			response.Instances = append(response.Instances, getInstanceSummary(statefulSet))
+		}
+		if next != nil {
+			response.NextPageToken = next.encode()
+			return response, nil
+		}
+		token = pageToken{Kind: workloadDeployment}
+	}
+	remaining := pageSize - int64(len(response.Instances))
+	if remaining == 0 {
+		response.NextPageToken = token.encode()
+		return response, nil
+	}
+	deployments, next, err := s.listWorkloads(ctx, request.Namespace, selector, remaining, token)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: "", prometheus.LabelOperation: "list"})
+		return models.ListResponse{}, err
+	}
+	for _, deployment := range deployments {
+		response.Instances = append(response.Instances, getInstanceSummary(deployment))
+	}
+	if next != nil {
+		response.NextPageToken = next.encode()
+	}
+	return response, nil
+}
+
+// pageToken is the opaque page_token of List. Pages listed from the apiserver carry its continue
+// token, pages listed from the cache the name of their last workload, since informers can't page.
+type pageToken struct {
+	Kind     string `json:"kind"`
+	Continue string `json:"continue,omitempty"`
+	After    string `json:"after,omitempty"`
+}
+
+func (t pageToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(encoded string) (pageToken, error) {
+	var token pageToken
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(data, &token)
+	}
+	if err != nil || (token.Kind != workloadStatefulSet && token.Kind != workloadDeployment) || (token.Continue != "" && token.After != "") {
+		return pageToken{}, fmt.Errorf(invalidPageTokenError, encoded)
+	}
+	return token, nil
+}
+
+// listWorkloads returns a page of the workloads of the token kind along with the token of the next
+// page, nil on the last one. Pages are listed from the cache once synced, but a continue token is
+// only understood by the apiserver that issued it.
+func (s *Postgres) listWorkloads(ctx context.Context, namespace string, selector labels.Selector, limit int64, token pageToken) ([]*workload, *pageToken, error) {
+	c := s.config.Cache
+	if c.isSynced() && token.Continue == "" {
+		return c.listWorkloads(namespace, selector, limit, token)
+	}
+	options := metav1.ListOptions{LabelSelector: selector.String(), Limit: limit, Continue: token.Continue}
+	// Pages of the cache of another replica are continued by name from the whole list
+	if token.After != "" {
+		options.Limit = 0
+	}
+	var workloads []*workload
+	var next string
+	if token.Kind == workloadStatefulSet {
+		statefulSets, err := s.kubeClient.AppsV1().StatefulSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		for idx := range statefulSets.Items {
+			workloads = append(workloads, fromStatefulSet(&statefulSets.Items[idx]))
+		}
+		next = statefulSets.Continue
+	} else {
+		deployments, err := s.kubeClient.AppsV1().Deployments(namespace).List(ctx, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		for idx := range deployments.Items {
+			workloads = append(workloads, fromDeployment(&deployments.Items[idx]))
+		}
+		next = deployments.Continue
+	}
+	if token.After != "" {
+		workloads, nextToken := pageWorkloads(workloads, limit, token)
+		return workloads, nextToken, nil
+	}
+	if next == "" {
+		return workloads, nil, nil
+	}
+	return workloads, &pageToken{Kind: token.Kind, Continue: next}, nil
+}
+
+func (s *Postgres) Watch(ctx context.Context, request models.WatchRequest) (<-chan models.WatchEvent, error) {
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "watch"})
+	request.Namespace = s.namespace(request.Namespace, "")
+	workloadOptions := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", request.ID).String()}
+	claimOptions := metav1.ListOptions{LabelSelector: labels.Set(instanceLabels(request.ID, componentStorage)).String()}
+	podOptions := metav1.ListOptions{LabelSelector: labels.Set{labelInstance: request.ID}.String()}
+	// Initial state is listed first so the watches can resume from its resource version
+	workload, workloadWatcher, err := s.watchWorkload(ctx, request.Namespace, request.ID, workloadOptions)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "watch"})
+		return nil, err
+	}
+	claims, err := s.kubeClient.CoreV1().PersistentVolumeClaims(request.Namespace).List(ctx, claimOptions)
+	if err != nil {
+		workloadWatcher.Stop()
+		return nil, err
+	}
+	pods, err := s.kubeClient.CoreV1().Pods(request.Namespace).List(ctx, podOptions)
+	if err != nil {
+		workloadWatcher.Stop()
+		return nil, err
+	}
+	claimWatcher, err := watchtools.NewRetryWatcher(claims.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = claimOptions.LabelSelector
+			return s.kubeClient.CoreV1().PersistentVolumeClaims(request.Namespace).Watch(ctx, options)
+		},
+	})
+	if err != nil {
+		workloadWatcher.Stop()
+		return nil, err
+	}
+	podWatcher, err := watchtools.NewRetryWatcher(pods.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = podOptions.LabelSelector
+			return s.kubeClient.CoreV1().Pods(request.Namespace).Watch(ctx, options)
+		},
+	})
+	if err != nil {
+		workloadWatcher.Stop()
+		claimWatcher.Stop()
+		return nil, err
+	}
+	events := make(chan models.WatchEvent)
+	watcher := newInstanceWatcher(request.ID, events)
+	go func() {
+		defer close(events)
+		defer workloadWatcher.Stop()
+		defer claimWatcher.Stop()
+		defer podWatcher.Stop()
+		for idx := range claims.Items {
+			if !watcher.onClaim(ctx, watch.Added, &claims.Items[idx]) {
+				return
+			}
+		}
+		for idx := range pods.Items {
+			if !watcher.onPod(ctx, watch.Added, &pods.Items[idx]) {
+				return
+			}
+		}
+		if !watcher.onWorkload(ctx, watch.Added, workload) {
+			return
+		}
+		watcher.run(ctx, workloadWatcher.ResultChan(), claimWatcher.ResultChan(), podWatcher.ResultChan())
+	}()
+	return events, nil
+}
+
+// watchWorkload lists the StatefulSet of an instance, or the Deployment of older instances, and
+// watches it from the listed resource version.
+func (s *Postgres) watchWorkload(ctx context.Context, namespace, id string, options metav1.ListOptions) (*workload, *watchtools.RetryWatcher, error) {
+	statefulSets, err := s.kubeClient.AppsV1().StatefulSets(namespace).List(ctx, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(statefulSets.Items) > 0 {
+		watcher, err := watchtools.NewRetryWatcher(statefulSets.ResourceVersion, &cache.ListWatch{
+			WatchFunc: func(watchOptions metav1.ListOptions) (watch.Interface, error) {
+				watchOptions.FieldSelector = options.FieldSelector
+				return s.kubeClient.AppsV1().StatefulSets(namespace).Watch(ctx, watchOptions)
+			},
+		})
+		return fromStatefulSet(&statefulSets.Items[0]), watcher, err
+	}
+	deployments, err := s.kubeClient.AppsV1().Deployments(namespace).List(ctx, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(deployments.Items) == 0 {
+		return nil, nil, apierrors.NewNotFound(appsv1.Resource("statefulsets"), id)
+	}
+	watcher, err := watchtools.NewRetryWatcher(deployments.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(watchOptions metav1.ListOptions) (watch.Interface, error) {
+			watchOptions.FieldSelector = options.FieldSelector
+			return s.kubeClient.AppsV1().Deployments(namespace).Watch(ctx, watchOptions)
+		},
+	})
+	return fromDeployment(&deployments.Items[0]), watcher, err
+}
+
+func (s *Postgres) Delete(ctx context.Context, request models.DeleteRequest) (models.DeleteResponse, error) {
 	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "delete"})
-	deletePolicy := metav1.DeletePropagationForeground
-	if err := s.kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).Delete(ctx, request.ID, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
-	}); err != nil {
+	request.Namespace = s.namespace(request.Namespace, "")
+	// Objects left by a previous delete are still deleted once the workload is gone
+	kind := ""
+	workload, err := s.getWorkload(ctx, request.Namespace, request.ID)
+	switch {
+	case err == nil:
+		kind = workload.kind
+	case !apierrors.IsNotFound(err):
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "delete"})
+		return models.DeleteResponse{}, err
+	}
+	response, err := s.deleteObjects(ctx, request.Namespace, request.ID, kind)
+	if err != nil {
 		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "delete"})
+	}
+	return response, err
+}
+
+// deleteClaims deletes the claim of a Deployment or the claims created from StatefulSet templates
+func (s *Postgres) deleteClaims(ctx context.Context, namespace, id string) error {
+	claims, err := s.kubeClient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set(instanceLabels(id, componentStorage)).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, claim := range claims.Items {
+		if err := s.kubeClient.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, claim.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Postgres) Update(ctx context.Context, request models.UpdateRequest) error {
+	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	request.Namespace = s.namespace(request.Namespace, "")
+	mask := sets.New(updatePaths(request)...)
+	// Only the masked quantities are read from the request, so only the masked ones left empty take the
+	// defaults. The others keep their live values.
+	request.Resources = withDefaultResources(request.Resources, s.config.DefaultResources)
+	workload, err := s.getWorkload(ctx, request.Namespace, request.ID)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
 		return err
 	}
-	if err := s.kubeClient.CoreV1().Services(apiv1.NamespaceDefault).Delete(ctx, postgresPrefix+request.ID, metav1.DeleteOptions{}); err != nil {
+	if err := s.migrateCredentials(ctx, request.Namespace, request.ID, workload); err != nil {
+		return err
+	}
+	if mask.Has(updatePathCapacity) {
+		if err := s.updateStorage(ctx, request); err != nil {
+			return err
+		}
+	}
+	if mask.Has(updatePathPortNum) {
+		names := []string{postgresPrefix + request.ID}
+		if workload.kind == workloadStatefulSet {
+			names = append(names, postgresHeadlessPrefix+request.ID, postgresReadOnlyPrefix+request.ID)
+		}
+		for _, name := range names {
+			if err := s.updateService(ctx, request, name); err != nil {
+				return err
+			}
+		}
+		if err := s.updateNetworkPolicy(ctx, request); err != nil {
+			return err
+		}
+		// Standbys created before the connection to the primary was written on every start
+		if workload.kind == workloadStatefulSet {
+			if err := apply(ctx, s.kubeClient.CoreV1().ConfigMaps(request.Namespace).Apply, setReplicationConfigMap(request.ID)); err != nil {
+				_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+				return err
+			}
+		}
+	}
+	if mask.Has(updatePathReplicas) {
+		if err := apply(ctx, s.kubeClient.PolicyV1().PodDisruptionBudgets(request.Namespace).Apply, setPodDisruptionBudget(request.Replicas, request.ID)); err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+			return err
+		}
+	}
+	if workload.kind == workloadDeployment {
+		if mask.HasAny(updatePathReplicas, updatePathPortNum, updatePathImageTag, updatePathImage) || mask.HasAny(resourcePaths...) {
+			return s.updateDeployment(ctx, request, mask)
+		}
+		return nil
+	}
+	if mask.Has(updatePathReplicas) && request.Replicas > workload.replicas {
+		if err := s.createReplicaVolumes(ctx, request.Namespace, request.ID, workload, request.Replicas); err != nil {
+			return err
+		}
+	}
+	if mask.HasAny(updatePathReplicas, updatePathPortNum, updatePathImageTag, updatePathImage) || mask.HasAny(resourcePaths...) {
+		return s.updateStatefulSet(ctx, request, mask)
+	}
+	return nil
+}
+
+func (s *Postgres) updateDeployment(ctx context.Context, request models.UpdateRequest, mask sets.Set[string]) error {
+	deployments := s.kubeClient.AppsV1().Deployments(request.Namespace)
+	result, err := getManaged(ctx, deployments, s.config.Cache.deployment(request.Namespace), request.ID)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
 		return err
 	}
-	if err := s.kubeClient.CoreV1().PersistentVolumeClaims(apiv1.NamespaceDefault).Delete(ctx, postgresVolumeClaimPrefix+request.ID, metav1.DeleteOptions{}); err != nil {
+	// Only the fields we manage are applied again, the ones set by others are kept
+	config, err := appsv1ac.ExtractDeployment(result, fieldManager)
+	if err != nil {
 		return err
 	}
-	if err := s.kubeClient.CoreV1().PersistentVolumes().Delete(ctx, postgresVolumePrefix+request.ID, metav1.DeleteOptions{}); err != nil {
+	if config.Spec == nil {
+		config.WithSpec(appsv1ac.DeploymentSpec())
+	}
+	if mask.Has(updatePathReplicas) {
+		config.Spec.WithReplicas(request.Replicas)
+	}
+	if config.Spec.Template == nil {
+		config.Spec.WithTemplate(corev1ac.PodTemplateSpec())
+	}
+	updatePodTemplate(config.Spec.Template, &result.Spec.Template, request, mask)
+	_, err = deployments.Apply(ctx, config, applyOptions)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	}
+	return err
+}
+
+func (s *Postgres) updateStatefulSet(ctx context.Context, request models.UpdateRequest, mask sets.Set[string]) error {
+	statefulSets := s.kubeClient.AppsV1().StatefulSets(request.Namespace)
+	result, err := getManaged(ctx, statefulSets, s.config.Cache.statefulSet(request.Namespace), request.ID)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
 		return err
 	}
-	if err := s.kubeClient.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Delete(ctx, postgresSecretPrefix+request.ID, metav1.DeleteOptions{}); err != nil {
+	config, err := appsv1ac.ExtractStatefulSet(result, fieldManager)
+	if err != nil {
 		return err
 	}
+	if config.Spec == nil {
+		config.WithSpec(appsv1ac.StatefulSetSpec())
+	}
+	if mask.Has(updatePathReplicas) {
+		config.Spec.WithReplicas(request.Replicas)
+	}
+	if config.Spec.Template == nil {
+		config.Spec.WithTemplate(corev1ac.PodTemplateSpec())
+	}
+	updatePodTemplate(config.Spec.Template, &result.Spec.Template, request, mask)
+	_, err = statefulSets.Apply(ctx, config, applyOptions)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	}
+	return err
+}
+
+// updatePodTemplate applies the masked fields shared by Deployments and StatefulSets to the managed
+// fields of the pod template. The current template tells which containers and variables there are.
+func updatePodTemplate(config *corev1ac.PodTemplateSpecApplyConfiguration, template *apiv1.PodTemplateSpec, request models.UpdateRequest, mask sets.Set[string]) {
+	if !mask.HasAny(updatePathPortNum, updatePathImageTag, updatePathImage) && !mask.HasAny(resourcePaths...) {
+		return
+	}
+	if config.Spec == nil {
+		config.WithSpec(corev1ac.PodSpec())
+	}
+	spec := config.Spec
+	resources := maskedResources(getResources(template), request.Resources, mask.HasAny)
+	var image string
+	if len(template.Spec.Containers) > 0 {
+		image = updatedImage(template.Spec.Containers[0].Image, request, mask)
+	}
+	for _, current := range template.Spec.InitContainers {
+		container := applyContainer(&spec.InitContainers, current.Name)
+		updateContainer(container, current, request, resources, mask)
+		// Init containers run the image of the primary, the standby clone needs its version
+		if mask.HasAny(updatePathImage, updatePathImageTag) {
+			container.WithImage(image)
+		}
+	}
+	for idx, current := range template.Spec.Containers {
+		container := applyContainer(&spec.Containers, current.Name)
+		updateContainer(container, current, request, resources, mask)
+		// Only the postgres container listens and runs the requested image
+		if idx > 0 {
+			continue
+		}
+		if mask.Has(updatePathPortNum) && len(current.Ports) > 0 {
+			if len(container.Ports) > 0 {
+				container.Ports[0].WithContainerPort(request.PortNum)
+			} else {
+				container.WithPorts(corev1ac.ContainerPort().WithContainerPort(request.PortNum))
+			}
+		}
+		if mask.HasAny(updatePathImage, updatePathImageTag) {
+			container.WithImage(image)
+		}
+	}
+}
+
+// updateContainer applies the masked fields shared by every container of the pod template
+func updateContainer(container *corev1ac.ContainerApplyConfiguration, current apiv1.Container, request models.UpdateRequest, resources models.Resources, mask sets.Set[string]) {
+	if mask.Has(updatePathPortNum) && hasEnv(current, envPGPort) {
+		applyEnvValue(container, envPGPort, fmt.Sprint(request.PortNum))
+	}
+	if mask.HasAny(resourcePaths...) {
+		container.WithResources(applyResources(resources))
+	}
+}
+
+// createReplicaVolumes creates the volumes claimed by the replicas added on scale up. Volumes of
+// replicas removed on a previous scale down are kept along with their claims, so they are reused as
+// they are, since they may have been expanded after the claim template.
+func (s *Postgres) createReplicaVolumes(ctx context.Context, namespace, id string, workload *workload, replicas int32) error {
+	if len(workload.claimTemplates) == 0 || !isHostPath(&workload.claimTemplates[0]) {
+		return nil
+	}
+	claimSpec := workload.claimTemplates[0].Spec
+	capacity := claimSpec.Resources.Requests[apiv1.ResourceStorage]
+	accessModes := make([]string, len(claimSpec.AccessModes))
+	for idx, accessMode := range claimSpec.AccessModes {
+		accessModes[idx] = string(accessMode)
+	}
+	for ordinal := workload.replicas; ordinal < replicas; ordinal++ {
+		persistentVolume := setReplicaPersistentVolume(capacity.String(), accessModes, namespace, id, ordinal)
+		if _, err := s.kubeClient.CoreV1().PersistentVolumes().Get(ctx, persistentVolume.Name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := apply(ctx, s.kubeClient.CoreV1().PersistentVolumes().Apply, persistentVolume); err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: id, prometheus.LabelOperation: "update"})
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *Postgres) Update(ctx context.Context, request models.UpdateRequest) error {
-	_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
-	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		// Retrieve the latest version of Deployment before attempting update
-		// RetryOnConflict uses exponential backoff to avoid exhausting the apiserver
-		result, err := s.kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).Get(ctx, request.ID, metav1.GetOptions{})
+func (s *Postgres) updateService(ctx context.Context, request models.UpdateRequest, name string) error {
+	services := s.kubeClient.CoreV1().Services(request.Namespace)
+	result, err := getManaged(ctx, services, s.config.Cache.service(request.Namespace), name)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+		return err
+	}
+	config, err := corev1ac.ExtractService(result, fieldManager)
+	if err != nil || config.Spec == nil {
+		return err
+	}
+	for idx := range config.Spec.Ports {
+		config.Spec.Ports[idx].WithPort(request.PortNum).WithTargetPort(intstr.FromInt32(request.PortNum))
+	}
+	_, err = services.Apply(ctx, config, applyOptions)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+	}
+	return err
+}
+
+// migrateCredentials moves the credentials of instances created before the Secret was introduced
+// out of the ConfigMap, pointing the Deployment's container environment to the new Secret. StatefulSets
+// were always created along with the Secret.
+func (s *Postgres) migrateCredentials(ctx context.Context, namespace, id string, workload *workload) error {
+	if workload.kind != workloadDeployment {
+		return nil
+	}
+	if _, err := readThrough(ctx, s.config.Cache.secret(namespace), s.kubeClient.CoreV1().Secrets(namespace).Get, postgresCredentialsPrefix+id); !apierrors.IsNotFound(err) {
+		return err
+	}
+	configMap, err := readThrough(ctx, s.config.Cache.configMap(namespace), s.kubeClient.CoreV1().ConfigMaps(namespace).Get, postgresConfigMapPrefix+id)
+	if err != nil {
+		return err
+	}
+	// A Secret deleted by hand after the migration has nothing left to move
+	if _, ok := configMap.Data[envPostgresUser]; !ok {
+		return nil
+	}
+	secret := setSecret(configMap.Data[envPostgresUser], configMap.Data[envPostgresPassword], id)
+	if err = apply(ctx, s.kubeClient.CoreV1().Secrets(namespace).Apply, secret); err != nil {
+		return err
+	}
+	deployments := s.kubeClient.AppsV1().Deployments(namespace)
+	result, err := getManaged(ctx, deployments, s.config.Cache.deployment(namespace), id)
+	if err != nil {
+		return err
+	}
+	config, err := appsv1ac.ExtractDeployment(result, fieldManager)
+	if err != nil {
+		return err
+	}
+	if config.Spec == nil {
+		config.WithSpec(appsv1ac.DeploymentSpec())
+	}
+	if config.Spec.Template == nil {
+		config.Spec.WithTemplate(corev1ac.PodTemplateSpec())
+	}
+	if config.Spec.Template.Spec == nil {
+		config.Spec.Template.WithSpec(corev1ac.PodSpec())
+	}
+	if containers := result.Spec.Template.Spec.Containers; len(containers) > 0 {
+		container := applyContainer(&config.Spec.Template.Spec.Containers, containers[0].Name)
+		for _, env := range credentialsEnv(id) {
+			envConfig, err := applyConfiguration[corev1ac.EnvVarApplyConfiguration](env)
+			if err != nil {
+				return err
+			}
+			container.WithEnv(envConfig)
+		}
+	}
+	if _, err = deployments.Apply(ctx, config, applyOptions); err != nil {
+		return err
+	}
+	// Credentials are only removed once no pod template reads them from the ConfigMap. They were set by
+	// the plain creates of earlier versions, so they are removed by a patch rather than left out of an apply.
+	patch, err := json.Marshal(map[string]any{"data": map[string]any{envPostgresUser: nil, envPostgresPassword: nil}})
+	if err != nil {
+		return err
+	}
+	_, err = s.kubeClient.CoreV1().ConfigMaps(namespace).Patch(ctx, postgresConfigMapPrefix+id, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	return err
+}
+
+// updateStorage expands the claims and their volumes, shrinking is rejected by the apiserver. Claims
+// created from StatefulSet templates are expanded one by one since templates cannot be changed.
+func (s *Postgres) updateStorage(ctx context.Context, request models.UpdateRequest) error {
+	capacity := resource.MustParse(request.Capacity)
+	listOptions := metav1.ListOptions{LabelSelector: labels.Set(instanceLabels(request.ID, componentStorage)).String()}
+	persistentVolumes, err := s.kubeClient.CoreV1().PersistentVolumes().List(ctx, listOptions)
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+		return err
+	}
+	for _, persistentVolume := range persistentVolumes.Items {
+		result, err := getManaged(ctx, s.kubeClient.CoreV1().PersistentVolumes(), nil, persistentVolume.Name)
 		if err != nil {
 			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
 			return err
 		}
-		result.Spec.Replicas = &request.Replicas
-		_, err = s.kubeClient.AppsV1().Deployments(apiv1.NamespaceDefault).Update(ctx, result, metav1.UpdateOptions{})
+		config, err := corev1ac.ExtractPersistentVolume(result, fieldManager)
 		if err != nil {
+			return err
+		}
+		if config.Spec == nil {
+			config.WithSpec(corev1ac.PersistentVolumeSpec())
+		}
+		config.Spec.WithCapacity(apiv1.ResourceList{apiv1.ResourceStorage: capacity})
+		if _, err := s.kubeClient.CoreV1().PersistentVolumes().Apply(ctx, config, applyOptions); err != nil {
 			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+			return err
 		}
+	}
+	claims, err := s.listClaims(ctx, request.Namespace, instanceLabels(request.ID, componentStorage))
+	if err != nil {
+		_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
 		return err
-	})
+	}
+	// Claims created by the StatefulSet controller only get the requested storage managed by us
+	persistentVolumeClaims := s.kubeClient.CoreV1().PersistentVolumeClaims(request.Namespace)
+	for _, claim := range claims {
+		result, err := getManaged(ctx, persistentVolumeClaims, s.config.Cache.claim(request.Namespace), claim.Name)
+		if err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "read"})
+			return err
+		}
+		config, err := corev1ac.ExtractPersistentVolumeClaim(result, fieldManager)
+		if err != nil {
+			return err
+		}
+		if config.Spec == nil {
+			config.WithSpec(corev1ac.PersistentVolumeClaimSpec())
+		}
+		config.Spec.WithResources(corev1ac.VolumeResourceRequirements().WithRequests(apiv1.ResourceList{apiv1.ResourceStorage: capacity}))
+		if _, err := persistentVolumeClaims.Apply(ctx, config, applyOptions); err != nil {
+			_ = s.metrics.IncreaseCounterMetric(prometheus.MetricDeploymentAccessFailedTotal, 1, map[string]string{prometheus.LabelID: request.ID, prometheus.LabelOperation: "update"})
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePaths returns the fields to update, requests without mask only update replicas
+func updatePaths(request models.UpdateRequest) []string {
+	if len(request.UpdateMask) == 0 {
+		return []string{updatePathReplicas}
+	}
+	return request.UpdateMask
+}
+
+// instanceID returns a new id, or the one derived from the client request ID
+func instanceID(request models.CreateRequest) string {
+	if request.RequestID != "" {
+		return idempotentID(request)
+	}
+	return uuid.New().String()
 }
 
-func setConfigMap(dbName, user, pass, id string) *apiv1.ConfigMap {
-	labelData := map[string]string{
-		"app": "postgres",
+// idempotentID derives the instance id from the client request ID, scoped by owner
+func idempotentID(request models.CreateRequest) string {
+	return uuid.NewSHA1(requestIDNamespace, []byte(request.Owner+"/"+request.RequestID)).String()
+}
+
+// specHash identifies the spec a request ID was first used with
+func specHash(request models.CreateRequest) string {
+	request.RequestID = ""
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func getResponse(id string, workload *workload, service *apiv1.Service, persistentVolumeClaim *apiv1.PersistentVolumeClaim, configMap *apiv1.ConfigMap) models.GetResponse {
+	response := models.GetResponse{
+		ID:                id,
+		Namespace:         workload.namespace,
+		DBName:            configMap.Data[envPostgresDB],
+		Workload:          workload.kind,
+		Replicas:          workload.replicas,
+		ReadyReplicas:     workload.readyReplicas,
+		AvailableReplicas: workload.availableReplicas,
+		CreatedAt:         workload.createdAt,
+	}
+	if containers := workload.template.Spec.Containers; len(containers) > 0 && len(containers[0].Ports) > 0 {
+		response.PortNum = containers[0].Ports[0].ContainerPort
+	}
+	if len(service.Spec.Ports) > 0 {
+		response.NodePort = service.Spec.Ports[0].NodePort
+	}
+	response.Endpoint = getEndpoint(service)
+	if containers := workload.template.Spec.Containers; len(containers) > 0 {
+		response.Image = containers[0].Image
+	}
+	response.Resources = getResources(&workload.template)
+	response.Probes = getProbes(&workload.template)
+	if capacity, ok := persistentVolumeClaim.Spec.Resources.Requests[apiv1.ResourceStorage]; ok {
+		response.Capacity = capacity.String()
+	}
+	if len(persistentVolumeClaim.Spec.AccessModes) > 0 {
+		response.AccessMode = string(persistentVolumeClaim.Spec.AccessModes[0])
+	}
+	if persistentVolumeClaim.Spec.StorageClassName != nil {
+		response.StorageClass = *persistentVolumeClaim.Spec.StorageClassName
+	}
+	return response
+}
+
+func getInstanceSummary(workload *workload) models.InstanceSummary {
+	summary := models.InstanceSummary{
+		ID:                workload.name,
+		Namespace:         workload.namespace,
+		Owner:             workload.labels[labelOwner],
+		Workload:          workload.kind,
+		Replicas:          workload.replicas,
+		ReadyReplicas:     workload.readyReplicas,
+		AvailableReplicas: workload.availableReplicas,
+		CreatedAt:         workload.createdAt,
 	}
+	if containers := workload.template.Spec.Containers; len(containers) > 0 && len(containers[0].Ports) > 0 {
+		summary.PortNum = containers[0].Ports[0].ContainerPort
+	}
+	return summary
+}
+
+// instanceLabels returns the labels stamped on every object of an instance
+func instanceLabels(id, component string) map[string]string {
+	return map[string]string{
+		labelApp:       labelAppValue,
+		labelInstance:  id,
+		labelManagedBy: labelManagedByValue,
+		labelComponent: component,
+	}
+}
+
+// selectorLabels returns the labels selecting only the pods of an instance
+func selectorLabels(id string) map[string]string {
+	return map[string]string{
+		labelApp:      labelAppValue,
+		labelInstance: id,
+	}
+}
+
+func setSecret(user, pass, id string) *apiv1.Secret {
+	labelData := instanceLabels(id, componentConfig)
+	credentialsData := map[string][]byte{
+		envPostgresUser:                []byte(user),
+		envPostgresPassword:            []byte(pass),
+		envPostgresReplicationUser:     []byte(replicationUser),
+		envPostgresReplicationPassword: replicationPassword(),
+	}
+	return &apiv1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   postgresCredentialsPrefix + id,
+			Labels: labelData,
+		},
+		Type: apiv1.SecretTypeOpaque,
+		Data: credentialsData,
+	}
+}
+
+// credentialsEnv returns the container environment read from the instance Secret
+func credentialsEnv(id string) []apiv1.EnvVar {
+	env := make([]apiv1.EnvVar, 0, 2)
+	for _, key := range []string{envPostgresUser, envPostgresPassword} {
+		env = append(env, apiv1.EnvVar{
+			Name: key,
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{
+						Name: postgresCredentialsPrefix + id,
+					},
+					Key: key,
+				},
+			},
+		})
+	}
+	return env
+}
+
+func setConfigMap(dbName, id string) *apiv1.ConfigMap {
+	labelData := instanceLabels(id, componentConfig)
 	postgresData := map[string]string{
-		"POSTGRES_DB":       dbName,
-		"POSTGRES_USER":     user,
-		"POSTGRES_PASSWORD": pass,
+		envPostgresDB: dbName,
 	}
 	return &apiv1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
@@ -114,7 +1306,7 @@ func setConfigMap(dbName, user, pass, id string) *apiv1.ConfigMap {
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   postgresSecretPrefix + id,
+			Name:   postgresConfigMapPrefix + id,
 			Labels: labelData,
 		},
 		Data: postgresData,
@@ -127,10 +1319,8 @@ func setPersistentVolume(storage string, accessModes []string, id string) *apiv1
 		persistentVolumeAccessModes[idx] = apiv1.PersistentVolumeAccessMode(accessMode)
 	}
 	capacity := apiv1.ResourceList{apiv1.ResourceStorage: resource.MustParse(storage)}
-	labelData := map[string]string{
-		"app":  "postgres",
-		"type": "local",
-	}
+	labelData := instanceLabels(id, componentStorage)
+	labelData["type"] = "local"
 	return &apiv1.PersistentVolume{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "PersistentVolume",
@@ -141,27 +1331,24 @@ func setPersistentVolume(storage string, accessModes []string, id string) *apiv1
 			Labels: labelData,
 		},
 		Spec: apiv1.PersistentVolumeSpec{
-			StorageClassName: "manual",
+			StorageClassName: hostPathStorageClass,
 			AccessModes:      persistentVolumeAccessModes,
 			Capacity:         capacity,
 			PersistentVolumeSource: apiv1.PersistentVolumeSource{
 				HostPath: &apiv1.HostPathVolumeSource{
-					Path: "/data/postgresql",
+					Path: hostPathRoot + id,
 				},
 			},
 		},
 	}
 }
 
-func setPersistentVolumeClaim(storage string, accessModes []string, id string) *apiv1.PersistentVolumeClaim {
+func setPersistentVolumeClaim(storage string, accessModes []string, storageClassName, id string) *apiv1.PersistentVolumeClaim {
 	persistentVolumeClaimAccessModes := make([]apiv1.PersistentVolumeAccessMode, len(accessModes))
 	for idx, accessMode := range accessModes {
 		persistentVolumeClaimAccessModes[idx] = apiv1.PersistentVolumeAccessMode(accessMode)
 	}
-	storageClassName := "manual"
-	labelData := map[string]string{
-		"app": "postgres",
-	}
+	labelData := instanceLabels(id, componentStorage)
 	capacity := apiv1.ResourceList{apiv1.ResourceStorage: resource.MustParse(storage)}
 	return &apiv1.PersistentVolumeClaim{
 		TypeMeta: metav1.TypeMeta{
@@ -183,12 +1370,8 @@ func setPersistentVolumeClaim(storage string, accessModes []string, id string) *
 }
 
 func setService(port int32, id string) *apiv1.Service {
-	labelData := map[string]string{
-		"app": "postgres",
-	}
-	selector := map[string]string{
-		"app": "postgres",
-	}
+	labelData := instanceLabels(id, componentService)
+	selector := selectorLabels(id)
 	return &apiv1.Service{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Service",
@@ -201,62 +1384,136 @@ func setService(port int32, id string) *apiv1.Service {
 		Spec: apiv1.ServiceSpec{
 			Ports:    []apiv1.ServicePort{{Port: port}},
 			Selector: selector,
-			Type:     "NodePort",
+			Type:     apiv1.ServiceTypeClusterIP,
 		},
 	}
 }
 
-func setDeployment(replicas, port int32, id string) *appsv1.Deployment {
-	matchLabels := map[string]string{"app": "postgres"}
-	labels := map[string]string{"app": "postgres"}
-	pullPolicy := "IfNotPresent"
+func setDeployment(replicas, port int32, id, owner string) *appsv1.Deployment {
+	matchLabels := selectorLabels(id)
+	deploymentLabels := instanceLabels(id, componentDatabase)
+	if owner != "" {
+		deploymentLabels[labelOwner] = owner
+	}
+	template := setPodTemplate(port, id)
+	// Postgres listens on PGPORT, StatefulSets set it along with the replication environment
+	template.Spec.Containers[0].Env = append(template.Spec.Containers[0].Env, apiv1.EnvVar{Name: envPGPort, Value: fmt.Sprint(port)})
+	template.Spec.Volumes = []apiv1.Volume{{
+		Name: postgresDataVolume,
+		VolumeSource: apiv1.VolumeSource{
+			PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{
+				ClaimName: postgresVolumeClaimPrefix + id,
+			},
+		},
+	}}
 	return &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Deployment",
 			APIVersion: "apps/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: id,
+			Name:   id,
+			Labels: deploymentLabels,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: matchLabels,
 			},
-			Template: apiv1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: apiv1.PodSpec{
-					Volumes: []apiv1.Volume{{
-						Name: "postgresdata",
-						VolumeSource: apiv1.VolumeSource{
-							PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{
-								ClaimName: postgresVolumeClaimPrefix + id,
-							},
-						},
-					}},
-					Containers: []apiv1.Container{{
-						Name:            "postgres",
-						Image:           "postgres:14",
-						ImagePullPolicy: apiv1.PullPolicy(pullPolicy),
-						Ports: []apiv1.ContainerPort{{
-							ContainerPort: port,
-						}},
-						EnvFrom: []apiv1.EnvFromSource{{
-							ConfigMapRef: &apiv1.ConfigMapEnvSource{
-								LocalObjectReference: apiv1.LocalObjectReference{
-									Name: postgresSecretPrefix + id,
-								},
-							},
-						}},
-						VolumeMounts: []apiv1.VolumeMount{{
-							Name:      "postgresdata",
-							MountPath: "/var/lib/postgresql/data",
-						}},
-					}},
-				},
+			Template: template,
+		},
+	}
+}
+
+// setStatefulSet gives each replica its own claim through volumeClaimTemplates, named
+// postgresdata-<id>-<ordinal> by the StatefulSet controller.
+func setStatefulSet(replicas, port int32, storage string, accessModes []string, storageClassName, id, owner string) *appsv1.StatefulSet {
+	matchLabels := selectorLabels(id)
+	statefulSetLabels := instanceLabels(id, componentDatabase)
+	if owner != "" {
+		statefulSetLabels[labelOwner] = owner
+	}
+	persistentVolumeClaim := setPersistentVolumeClaim(storage, accessModes, storageClassName, id)
+	persistentVolumeClaim.Name = postgresDataVolume
+	template := setPodTemplate(port, id)
+	setReplication(&template, port, id)
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   id,
+			Labels: statefulSetLabels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: postgresHeadlessPrefix + id,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: matchLabels,
+			},
+			Template:             template,
+			VolumeClaimTemplates: []apiv1.PersistentVolumeClaim{*persistentVolumeClaim},
+			// Claims are owned by the StatefulSet, those of replicas removed on scale down are kept for reuse
+			PersistentVolumeClaimRetentionPolicy: &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
 			},
 		},
 	}
 }
+
+func setPodTemplate(port int32, id string) apiv1.PodTemplateSpec {
+	podLabels := instanceLabels(id, componentDatabase)
+	pullPolicy := "IfNotPresent"
+	return apiv1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: podLabels,
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{
+				Name:            "postgres",
+				Image:           defaultPostgresImage,
+				ImagePullPolicy: apiv1.PullPolicy(pullPolicy),
+				Ports: []apiv1.ContainerPort{{
+					ContainerPort: port,
+				}},
+				EnvFrom: []apiv1.EnvFromSource{{
+					ConfigMapRef: &apiv1.ConfigMapEnvSource{
+						LocalObjectReference: apiv1.LocalObjectReference{
+							Name: postgresConfigMapPrefix + id,
+						},
+					},
+				}},
+				Env: credentialsEnv(id),
+				VolumeMounts: []apiv1.VolumeMount{{
+					Name:      postgresDataVolume,
+					MountPath: "/var/lib/postgresql/data",
+				}},
+			}},
+		},
+	}
+}
+
+// setHeadlessService gives the StatefulSet pods stable network identities
+func setHeadlessService(port int32, id string) *apiv1.Service {
+	service := setService(port, id)
+	service.Name = postgresHeadlessPrefix + id
+	service.Spec.Type = apiv1.ServiceTypeClusterIP
+	service.Spec.ClusterIP = apiv1.ClusterIPNone
+	return service
+}
+
+// setReplicaPersistentVolume pre-binds a volume with its own host directory to the claim
+// the StatefulSet controller creates for the given replica.
+func setReplicaPersistentVolume(storage string, accessModes []string, namespace, id string, ordinal int32) *apiv1.PersistentVolume {
+	claimName := fmt.Sprintf("%s-%s-%d", postgresDataVolume, id, ordinal)
+	persistentVolume := setPersistentVolume(storage, accessModes, id)
+	persistentVolume.Name = fmt.Sprintf("%s%s-%d", postgresVolumePrefix, id, ordinal)
+	persistentVolume.Spec.HostPath.Path = fmt.Sprintf("%s%s-%d", hostPathRoot, id, ordinal)
+	persistentVolume.Spec.ClaimRef = &apiv1.ObjectReference{
+		Namespace: namespace,
+		Name:      claimName,
+	}
+	return persistentVolume
+}
@@ -0,0 +1,1021 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"schwarz/models"
+	"schwarz/services/prometheus"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// GIVEN Postgres Create
+func TestCreatePostgres(t *testing.T) {
+	request := models.CreateRequest{
+		DBName:     "dbName",
+		UserName:   "user_name",
+		UserPass:   "user_pass",
+		PortNum:    5432,
+		Replicas:   1,
+		Capacity:   "10Mi",
+		AccessMode: "ReadWriteOnce",
+		RequestID:  "retry-key",
+	}
+	changed := request
+	changed.Replicas = 2
+	tcs := []struct {
+		description string
+		first       models.CreateRequest
+		replayed    models.CreateRequest
+		sameID      bool
+		expectedErr error
+	}{
+		{
+			description: "WHEN request ID is replayed with the same spec THEN the existing id is returned",
+			first:       request,
+			replayed:    request,
+			sameID:      true,
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN request ID is replayed with a different spec THEN requestIDConflictError",
+			first:       request,
+			replayed:    changed,
+			expectedErr: fmt.Errorf(createStepError, stepSecret, fmt.Errorf(requestIDConflictError, request.RequestID)),
+		},
+		{
+			description: "WHEN request ID is not set THEN a new instance is created",
+			first:       models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce"},
+			replayed:    models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce"},
+			sameID:      false,
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			postgres := NewPostgres(newFakeClientset(), newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+			first, err := postgres.Create(context.Background(), tc.first)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			replayed, err := postgres.Create(context.Background(), tc.replayed)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			} else if err == nil && (first.ID == replayed.ID) != tc.sameID {
+				t.Errorf("expected same id = %t, first = %s, replayed = %s", tc.sameID, first.ID, replayed.ID)
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create replay after a partial failure
+func TestCreatePostgresPartialReplay(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	request := models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", RequestID: "retry-key"}
+	id := idempotentID(request)
+	// Simulate a previous attempt which only created the Secret, hashing the spec with its namespace resolved
+	resolved := request
+	resolved.Namespace = metav1.NamespaceDefault
+	secret := setSecret(request.UserName, request.UserPass, id)
+	secret.Annotations = map[string]string{annotationRequestID: request.RequestID, annotationSpecHash: specHash(resolved)}
+	if _, err := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Create(context.Background(), secret, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	response, err := postgres.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if response.ID != id {
+		t.Errorf("expected id = %s, got %s", id, response.ID)
+	}
+	if _, err := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), id, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected statefulset to be created, got error %v", err)
+	}
+}
+
+// GIVEN Postgres Create failing on a later step
+func TestCreatePostgresRollback(t *testing.T) {
+	tcs := []struct {
+		description string
+		failing     string
+		workload    string
+		expectedErr error
+	}{
+		{
+			description: "WHEN service creation fails THEN every previous object is deleted and the step is reported",
+			failing:     "services",
+			workload:    workloadDeployment,
+			expectedErr: fmt.Errorf(createStepError, stepService, errors.New("random")),
+		},
+		{
+			description: "WHEN persistent volume claim creation fails THEN every previous object is deleted and the step is reported",
+			failing:     "persistentvolumeclaims",
+			workload:    workloadDeployment,
+			expectedErr: fmt.Errorf(createStepError, stepPersistentVolumeClaim, errors.New("random")),
+		},
+		{
+			description: "WHEN statefulset creation fails THEN every replica volume is deleted and the step is reported",
+			failing:     "statefulsets",
+			workload:    workloadStatefulSet,
+			expectedErr: fmt.Errorf(createStepError, stepStatefulSet, errors.New("random")),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			kubeClient := newFakeClientset()
+			kubeClient.PrependReactor("patch", tc.failing, func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("random")
+			})
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+			_, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Workload: tc.workload})
+			if err == nil || err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+			secrets, _ := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+			configMaps, _ := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+			volumes, _ := kubeClient.CoreV1().PersistentVolumes().List(context.Background(), metav1.ListOptions{})
+			claims, _ := kubeClient.CoreV1().PersistentVolumeClaims(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+			deployments, _ := kubeClient.AppsV1().Deployments(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+			services, _ := kubeClient.CoreV1().Services(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+			if left := len(secrets.Items) + len(configMaps.Items) + len(volumes.Items) + len(claims.Items) + len(deployments.Items) + len(services.Items); left != 0 {
+				t.Errorf("expected no objects left, got %d", left)
+			}
+		})
+	}
+}
+
+// GIVEN a created instance whose request is replayed
+func TestCreatePostgresReplayFailureKeepsInstance(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	request := models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", RequestID: "retry-key"}
+	response, err := postgres.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN a step of the replay creating an object left missing fails THEN the objects of the instance are kept
+	if err := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Delete(context.Background(), postgresPrefix+response.ID, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	kubeClient.PrependReactor("patch", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("random")
+	})
+	if _, err := postgres.Create(context.Background(), request); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if _, err := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the Secret to be kept, got error %v", err)
+	}
+	if _, err := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the StatefulSet to be kept, got error %v", err)
+	}
+}
+
+// GIVEN a created instance updated before its request is replayed
+func TestCreatePostgresReplayKeepsUpdates(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	request := models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", RequestID: "retry-key"}
+	response, err := postgres.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathReplicas}, Replicas: 3}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN the request is replayed THEN the existing instance is returned as updated
+	replayed, err := postgres.Create(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if replayed.ID != response.ID || replayed.Endpoint != response.Endpoint {
+		t.Errorf("expected the existing instance %v, got %v", response, replayed)
+	}
+	statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if *statefulSet.Spec.Replicas != 3 {
+		t.Errorf("expected replicas = 3 to be kept, got %d", *statefulSet.Spec.Replicas)
+	}
+	podDisruptionBudget, _ := kubeClient.PolicyV1().PodDisruptionBudgets(metav1.NamespaceDefault).Get(context.Background(), postgresDisruptionBudgetPrefix+response.ID, metav1.GetOptions{})
+	if podDisruptionBudget.Spec.MinAvailable == nil || podDisruptionBudget.Spec.MinAvailable.IntValue() != 2 {
+		t.Errorf("expected the disruption budget of 3 replicas to be kept, got %v", podDisruptionBudget.Spec.MinAvailable)
+	}
+}
+
+// GIVEN Postgres Update of an instance keeping credentials in its ConfigMap
+func TestUpdatePostgresMigratesCredentials(t *testing.T) {
+	id := "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b"
+	configMap := setConfigMap("dbName", id)
+	configMap.Namespace = metav1.NamespaceDefault
+	configMap.Data[envPostgresUser] = "user_name"
+	configMap.Data[envPostgresPassword] = "user_pass"
+	deployment := setDeployment(1, 5432, id, "")
+	deployment.Namespace = metav1.NamespaceDefault
+	deployment.Spec.Template.Spec.Containers[0].Env = nil
+	kubeClient := newFakeClientset(configMap, deployment)
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: id, Replicas: 2}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	secret, err := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Get(context.Background(), postgresCredentialsPrefix+id, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected secret to be created, got error %v", err)
+	}
+	if string(secret.Data[envPostgresUser]) != "user_name" || string(secret.Data[envPostgresPassword]) != "user_pass" {
+		t.Errorf("unexpected secret data %v", secret.Data)
+	}
+	configMap, _ = kubeClient.CoreV1().ConfigMaps(metav1.NamespaceDefault).Get(context.Background(), postgresConfigMapPrefix+id, metav1.GetOptions{})
+	if diff := cmp.Diff(map[string]string{envPostgresDB: "dbName"}, configMap.Data); diff != "" {
+		t.Errorf("config map data has diff %s", diff)
+	}
+	deployment, _ = kubeClient.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.Background(), id, metav1.GetOptions{})
+	if diff := cmp.Diff(credentialsEnv(id), deployment.Spec.Template.Spec.Containers[0].Env); diff != "" {
+		t.Errorf("container env has diff %s", diff)
+	}
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected replicas = 2, got %d", *deployment.Spec.Replicas)
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("expected %s to be applied, got an update", action.GetResource().Resource)
+		}
+	}
+}
+
+// GIVEN a StatefulSet instance whose Secret was deleted by hand
+func TestUpdatePostgresSecretDeleted(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "password", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Delete(context.Background(), postgresCredentialsPrefix+response.ID, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN the instance is updated THEN no credentials are migrated and the update is applied
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathReplicas}, Replicas: 2}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if *statefulSet.Spec.Replicas != 2 {
+		t.Errorf("expected replicas = 2, got %d", *statefulSet.Spec.Replicas)
+	}
+	if _, err := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected no Secret to be made up, got error %v", err)
+	}
+}
+
+// GIVEN Postgres StatefulSet instance lifecycle
+func TestStatefulSetPostgres(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	statefulSet, err := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected statefulset to be created, got error %v", err)
+	}
+	if statefulSet.Spec.ServiceName != postgresHeadlessPrefix+response.ID || len(statefulSet.Spec.VolumeClaimTemplates) != 1 {
+		t.Errorf("unexpected statefulset spec %v", statefulSet.Spec)
+	}
+	headless, err := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Get(context.Background(), postgresHeadlessPrefix+response.ID, metav1.GetOptions{})
+	if err != nil || headless.Spec.ClusterIP != apiv1.ClusterIPNone {
+		t.Errorf("expected headless service, got %v, error %v", headless, err)
+	}
+	// WHEN replicas are scaled up THEN a volume is created for each new replica
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, Replicas: 3}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	volumes, _ := kubeClient.CoreV1().PersistentVolumes().List(context.Background(), metav1.ListOptions{})
+	paths := make([]string, len(volumes.Items))
+	for idx, volume := range volumes.Items {
+		paths[idx] = volume.Spec.HostPath.Path
+	}
+	expectedPaths := []string{
+		fmt.Sprintf("/data/postgresql/%s-0", response.ID),
+		fmt.Sprintf("/data/postgresql/%s-1", response.ID),
+		fmt.Sprintf("/data/postgresql/%s-2", response.ID),
+	}
+	if diff := cmp.Diff(expectedPaths, paths); diff != "" {
+		t.Errorf("volume paths have diff %s", diff)
+	}
+	service, _ := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Get(context.Background(), postgresPrefix+response.ID, metav1.GetOptions{})
+	if service.Spec.Selector[appsv1.StatefulSetPodNameLabel] != primaryPodName(response.ID) {
+		t.Errorf("expected read-write service to select the primary, got selector %v", service.Spec.Selector)
+	}
+	if _, err := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Get(context.Background(), postgresReadOnlyPrefix+response.ID, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected read-only service, got error %v", err)
+	}
+	for _, name := range []string{primaryPodName(response.ID), response.ID + "-1"} {
+		pod := &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault, Labels: selectorLabels(response.ID)}}
+		if _, err := kubeClient.CoreV1().Pods(metav1.NamespaceDefault).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	get, err := postgres.Get(context.Background(), models.GetRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if get.Workload != workloadStatefulSet || get.Replicas != 3 || get.Capacity != "10Mi" {
+		t.Errorf("unexpected get response %v", get)
+	}
+	expectedPods := []models.PodStatus{
+		{Name: primaryPodName(response.ID), Role: models.RolePrimary},
+		{Name: response.ID + "-1", Role: models.RoleReplica},
+	}
+	if diff := cmp.Diff(expectedPods, get.Pods); diff != "" {
+		t.Errorf("pods have diff %s", diff)
+	}
+	// WHEN instance is deleted THEN every object is deleted
+	if _, err := postgres.Delete(context.Background(), models.DeleteRequest{ID: response.ID}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	statefulSets, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	services, _ := kubeClient.CoreV1().Services(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	configMaps, _ := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	volumes, _ = kubeClient.CoreV1().PersistentVolumes().List(context.Background(), metav1.ListOptions{})
+	if left := len(statefulSets.Items) + len(services.Items) + len(configMaps.Items) + len(volumes.Items); left != 0 {
+		t.Errorf("expected no objects left, got %d", left)
+	}
+}
+
+// GIVEN Postgres Create with a storage class
+func TestCreatePostgresStorageClass(t *testing.T) {
+	defaultClass := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{
+		Name:        "standard",
+		Annotations: map[string]string{annotationDefaultStorageClass: "true"},
+	}}
+	fastClass := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}}
+	tcs := []struct {
+		description     string
+		storageClass    string
+		hostPath        bool
+		existing        []runtime.Object
+		expectedClass   string
+		expectedVolumes int
+		expectedErr     error
+	}{
+		{
+			description:   "WHEN storage class exists THEN claims use it and no volume is created",
+			storageClass:  "fast",
+			existing:      []runtime.Object{defaultClass, fastClass},
+			expectedClass: "fast",
+		},
+		{
+			description:  "WHEN storage class does not exist THEN storageClassNotFoundError",
+			storageClass: "slow",
+			existing:     []runtime.Object{defaultClass, fastClass},
+			expectedErr:  fmt.Errorf(storageClassNotFoundError, "slow"),
+		},
+		{
+			description:   "WHEN storage class is not set THEN claims use the default class",
+			existing:      []runtime.Object{fastClass, defaultClass},
+			expectedClass: "standard",
+		},
+		{
+			description: "WHEN storage class is not set and there is no default class THEN noDefaultStorageClassError",
+			existing:    []runtime.Object{fastClass},
+			expectedErr: fmt.Errorf(noDefaultStorageClassError),
+		},
+		{
+			description:     "WHEN storage class is not set in hostPath mode THEN a volume is created per replica",
+			hostPath:        true,
+			existing:        []runtime.Object{defaultClass},
+			expectedClass:   hostPathStorageClass,
+			expectedVolumes: 2,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			kubeClient := newFakeClientset(tc.existing...)
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: tc.hostPath})
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", StorageClass: tc.storageClass})
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Fatalf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil {
+				if err.Error() != tc.expectedErr.Error() {
+					t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+				}
+				return
+			}
+			statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+			if class := statefulSet.Spec.VolumeClaimTemplates[0].Spec.StorageClassName; class == nil || *class != tc.expectedClass {
+				t.Errorf("expected storage class = %s, received = %v", tc.expectedClass, class)
+			}
+			volumes, _ := kubeClient.CoreV1().PersistentVolumes().List(context.Background(), metav1.ListOptions{})
+			if len(volumes.Items) != tc.expectedVolumes {
+				t.Errorf("expected %d volumes, received %d", tc.expectedVolumes, len(volumes.Items))
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create in tenant mode
+func TestCreatePostgresTenantNamespace(t *testing.T) {
+	tcs := []struct {
+		description       string
+		owner             string
+		namespace         string
+		expectedNamespace string
+		expectedErr       error
+	}{
+		{
+			description:       "WHEN owner is set THEN the instance is created in the owner namespace, apart from owners only differing by case",
+			owner:             "team-a",
+			expectedNamespace: "postgres-tenant-team-a",
+		},
+		{
+			description:       "WHEN owner is not a valid namespace name THEN the namespace name has a hash suffix",
+			owner:             "Team_A",
+			expectedNamespace: tenantNamespace("Team_A"),
+		},
+		{
+			description: "WHEN owner is named after the namespace of another owner THEN namespaceNotOwnedError",
+			owner:       strings.TrimPrefix(tenantNamespace("Team-A"), tenantNamespacePrefix),
+			expectedErr: fmt.Errorf(namespaceNotOwnedError, tenantNamespace("Team-A"), strings.TrimPrefix(tenantNamespace("Team-A"), tenantNamespacePrefix)),
+		},
+		{
+			description: "WHEN namespace belongs to another owner THEN namespaceNotOwnedError",
+			owner:       "team-a",
+			namespace:   "postgres-tenant-team-b",
+			expectedErr: fmt.Errorf(namespaceNotOwnedError, "postgres-tenant-team-b", "team-a"),
+		},
+		{
+			description: "WHEN owner is not set THEN ownerRequiredError",
+			namespace:   "postgres-tenant-team-a",
+			expectedErr: fmt.Errorf(ownerRequiredError),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			kubeClient := newFakeClientset()
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true, DefaultNamespace: "databases", TenantNamespaces: true})
+			if _, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Owner: "Team-A"}); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Owner: tc.owner, Namespace: tc.namespace})
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Fatalf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil {
+				if err.Error() != tc.expectedErr.Error() {
+					t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if response.Namespace != tc.expectedNamespace {
+				t.Errorf("expected namespace = %s, received = %s", tc.expectedNamespace, response.Namespace)
+			}
+			if _, err := kubeClient.AppsV1().StatefulSets(tc.expectedNamespace).Get(context.Background(), response.ID, metav1.GetOptions{}); err != nil {
+				t.Errorf("expected statefulset in namespace %s, got error %v", tc.expectedNamespace, err)
+			}
+			if _, err := kubeClient.CoreV1().Namespaces().Get(context.Background(), tc.expectedNamespace, metav1.GetOptions{}); err != nil {
+				t.Errorf("expected tenant namespace, got error %v", err)
+			}
+			if _, err := kubeClient.CoreV1().ResourceQuotas(tc.expectedNamespace).Get(context.Background(), tenantResourceQuota, metav1.GetOptions{}); err != nil {
+				t.Errorf("expected tenant resource quota, got error %v", err)
+			}
+			if _, err := kubeClient.CoreV1().LimitRanges(tc.expectedNamespace).Get(context.Background(), tenantLimitRange, metav1.GetOptions{}); err != nil {
+				t.Errorf("expected tenant limit range, got error %v", err)
+			}
+			get, err := postgres.Get(context.Background(), models.GetRequest{ID: response.ID, Namespace: response.Namespace})
+			if err != nil || get.Namespace != tc.expectedNamespace {
+				t.Errorf("expected get in namespace %s, got %v, error %v", tc.expectedNamespace, get, err)
+			}
+		})
+	}
+}
+
+func newTestMetrics(t *testing.T) *prometheus.Prometheus {
+	t.Helper()
+	metrics, err := prometheus.NewPrometheusService(prometheus.GetMetricsDefinition())
+	if err != nil {
+		t.Fatalf("failed to load metric definitions: %v", err)
+	}
+	return metrics
+}
+
+// GIVEN Postgres Create and Update with resources
+func TestPostgresResources(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{
+		HostPathStorage:  true,
+		DefaultResources: models.Resources{CPURequest: "250m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"},
+	})
+	// WHEN only some quantities are requested THEN the others take the service defaults
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Resources: models.Resources{MemoryLimit: "2Gi"}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	for _, container := range append(statefulSet.Spec.Template.Spec.InitContainers, statefulSet.Spec.Template.Spec.Containers...) {
+		if limit := container.Resources.Limits[apiv1.ResourceMemory]; limit.String() != "2Gi" {
+			t.Errorf("expected container %s memory limit = 2Gi, received = %s", container.Name, limit.String())
+		}
+	}
+	// WHEN a single quantity is masked THEN only that one changes
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathCPULimit}, Resources: models.Resources{CPULimit: "2"}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	get, err := postgres.Get(context.Background(), models.GetRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := models.Resources{CPURequest: "250m", CPULimit: "2", MemoryRequest: "256Mi", MemoryLimit: "2Gi"}
+	if diff := cmp.Diff(expected, get.Resources); diff != "" {
+		t.Errorf("resources have diff %s", diff)
+	}
+}
+
+// GIVEN Postgres with a default image
+func TestPostgresImage(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true, DefaultImage: "15"})
+	tcs := []struct {
+		description string
+		image       string
+		expected    string
+	}{
+		{
+			description: "WHEN no image is requested THEN the default version of the official image runs",
+			expected:    "postgres:15",
+		},
+		{
+			description: "WHEN a version is requested THEN that version of the official image runs",
+			image:       "16",
+			expected:    "postgres:16",
+		},
+		{
+			description: "WHEN an image reference is requested THEN it runs as requested",
+			image:       "registry.example.com/postgres:16.2",
+			expected:    "registry.example.com/postgres:16.2",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Image: tc.image})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+			for _, container := range append(statefulSet.Spec.Template.Spec.InitContainers, statefulSet.Spec.Template.Spec.Containers...) {
+				if container.Image != tc.expected {
+					t.Errorf("expected container %s image = %s, received = %s", container.Name, tc.expected, container.Image)
+				}
+			}
+			get, err := postgres.Get(context.Background(), models.GetRequest{ID: response.ID})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if get.Image != tc.expected {
+				t.Errorf("expected image = %s, received = %s", tc.expected, get.Image)
+			}
+		})
+	}
+}
+
+// GIVEN an instance running a custom image
+func TestPostgresUpdateImage(t *testing.T) {
+	tcs := []struct {
+		description string
+		request     models.UpdateRequest
+		expected    string
+	}{
+		{
+			description: "WHEN only image_tag is updated THEN the repository running is kept",
+			request:     models.UpdateRequest{UpdateMask: []string{updatePathImageTag}, ImageTag: "16.3"},
+			expected:    "registry.example.com/postgres:16.3",
+		},
+		{
+			description: "WHEN image is updated THEN the reference runs as requested",
+			request:     models.UpdateRequest{UpdateMask: []string{updatePathImage}, Image: "mirror.example.com/postgres@sha256:" + strings.Repeat("a", 64)},
+			expected:    "mirror.example.com/postgres@sha256:" + strings.Repeat("a", 64),
+		},
+		{
+			description: "WHEN image is a version THEN that version of the official image runs",
+			request:     models.UpdateRequest{UpdateMask: []string{updatePathImage}, Image: "16"},
+			expected:    "postgres:16",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			kubeClient := newFakeClientset()
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Image: "registry.example.com/postgres:16.2"})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			tc.request.ID = response.ID
+			if err := postgres.Update(context.Background(), tc.request); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+			for _, container := range append(statefulSet.Spec.Template.Spec.InitContainers, statefulSet.Spec.Template.Spec.Containers...) {
+				if container.Name != volumeOwnershipContainer && container.Image != tc.expected {
+					t.Errorf("expected container %s image = %s, received = %s", container.Name, tc.expected, container.Image)
+				}
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create with probe settings
+func TestPostgresProbes(t *testing.T) {
+	tcs := []struct {
+		description string
+		workload    string
+		probes      models.Probes
+		expected    models.Probes
+	}{
+		{
+			description: "WHEN probes are not set THEN pods get the default probes",
+			expected:    models.Probes{PeriodSeconds: 10, TimeoutSeconds: 5, FailureThreshold: 3, StartupTimeoutSeconds: 300},
+		},
+		{
+			description: "WHEN startup timeout is not a multiple of the period THEN it is rounded up",
+			workload:    workloadDeployment,
+			probes:      models.Probes{PeriodSeconds: 20, StartupTimeoutSeconds: 90},
+			expected:    models.Probes{PeriodSeconds: 20, TimeoutSeconds: 5, FailureThreshold: 3, StartupTimeoutSeconds: 100},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			kubeClient := newFakeClientset()
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5433, Replicas: 1, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Workload: tc.workload, Probes: tc.probes})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			workload, err := postgres.(*Postgres).getWorkload(context.Background(), metav1.NamespaceDefault, response.ID)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			container := workload.template.Spec.Containers[0]
+			if container.StartupProbe == nil || container.ReadinessProbe == nil || container.LivenessProbe.Exec.Command[2] != pgIsReadyCommand {
+				t.Errorf("expected pg_isready probes, got %v", container)
+			}
+			if diff := cmp.Diff(tc.expected, getProbes(&workload.template)); diff != "" {
+				t.Errorf("probes have diff %s", diff)
+			}
+			port := ""
+			for _, env := range container.Env {
+				if env.Name == envPGPort {
+					port = env.Value
+				}
+			}
+			if port != "5433" {
+				t.Errorf("expected postgres to listen on port 5433, received %s", port)
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create in a namespace with a Pod Security level
+func TestCreatePostgresPodSecurity(t *testing.T) {
+	tcs := []struct {
+		description string
+		labels      map[string]string
+		minLevel    string
+		expectedErr error
+	}{
+		{
+			description: "WHEN namespace enforces restricted THEN hardened pods are created",
+			labels:      map[string]string{labelPodSecurityEnforce: podSecurityRestricted},
+			minLevel:    podSecurityRestricted,
+		},
+		{
+			description: "WHEN namespace has no level and no minimum is required THEN hardened pods are created",
+		},
+		{
+			description: "WHEN namespace enforces a level below the minimum THEN podSecurityMinLevelError",
+			labels:      map[string]string{labelPodSecurityEnforce: podSecurityBaseline},
+			minLevel:    podSecurityRestricted,
+			expectedErr: fmt.Errorf(podSecurityMinLevelError, "databases", podSecurityBaseline, podSecurityRestricted),
+		},
+		{
+			description: "WHEN namespace has no level and a minimum is required THEN podSecurityMinLevelError",
+			minLevel:    podSecurityBaseline,
+			expectedErr: fmt.Errorf(podSecurityMinLevelError, "databases", podSecurityPrivileged, podSecurityBaseline),
+		},
+		{
+			description: "WHEN namespace enforces an unknown level THEN podSecurityLevelError",
+			labels:      map[string]string{labelPodSecurityEnforce: "strict"},
+			expectedErr: fmt.Errorf(podSecurityLevelError, "databases", "strict"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			namespace := &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "databases", Labels: tc.labels}}
+			storageClass := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard", Annotations: map[string]string{annotationDefaultStorageClass: "true"}}}
+			kubeClient := newFakeClientset(namespace, storageClass)
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{MinPodSecurityLevel: tc.minLevel})
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Namespace: "databases"})
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Fatalf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil {
+				if err.Error() != tc.expectedErr.Error() {
+					t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+				}
+				secrets, _ := kubeClient.CoreV1().Secrets("databases").List(context.Background(), metav1.ListOptions{})
+				if len(secrets.Items) != 0 {
+					t.Errorf("expected no object to be created, got %d secrets", len(secrets.Items))
+				}
+				return
+			}
+			statefulSet, _ := kubeClient.AppsV1().StatefulSets("databases").Get(context.Background(), response.ID, metav1.GetOptions{})
+			podSecurity := statefulSet.Spec.Template.Spec.SecurityContext
+			if podSecurity == nil || !*podSecurity.RunAsNonRoot || *podSecurity.RunAsUser != postgresUID || *podSecurity.FSGroup != postgresUID || podSecurity.SeccompProfile.Type != apiv1.SeccompProfileTypeRuntimeDefault {
+				t.Errorf("expected restricted pod security context, got %v", podSecurity)
+			}
+			for _, container := range append(statefulSet.Spec.Template.Spec.InitContainers, statefulSet.Spec.Template.Spec.Containers...) {
+				security := container.SecurityContext
+				if security == nil || *security.AllowPrivilegeEscalation || len(security.Capabilities.Drop) != 1 || security.Capabilities.Drop[0] != "ALL" {
+					t.Errorf("expected container %s to drop every capability without privilege escalation, got %v", container.Name, security)
+				}
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create on hostPath storage
+func TestCreatePostgresHostPathSecurity(t *testing.T) {
+	tcs := []struct {
+		description string
+		labels      map[string]string
+		workload    string
+		expectedErr error
+	}{
+		{
+			description: "WHEN the workload is a StatefulSet THEN the data volume is given to the postgres user first",
+		},
+		{
+			description: "WHEN the workload is a Deployment THEN the data volume is given to the postgres user first",
+			workload:    workloadDeployment,
+		},
+		{
+			description: "WHEN namespace enforces baseline THEN the pods are created",
+			labels:      map[string]string{labelPodSecurityEnforce: podSecurityBaseline},
+		},
+		{
+			description: "WHEN namespace enforces restricted THEN podSecurityHostPathError",
+			labels:      map[string]string{labelPodSecurityEnforce: podSecurityRestricted},
+			expectedErr: fmt.Errorf(podSecurityHostPathError, "databases", podSecurityRestricted, podSecurityBaseline),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			namespace := &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "databases", Labels: tc.labels}}
+			kubeClient := newFakeClientset(namespace)
+			postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+			response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Namespace: "databases", Workload: tc.workload})
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Fatalf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil {
+				if err.Error() != tc.expectedErr.Error() {
+					t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+				}
+				return
+			}
+			var template apiv1.PodTemplateSpec
+			if tc.workload == workloadDeployment {
+				deployment, _ := kubeClient.AppsV1().Deployments("databases").Get(context.Background(), response.ID, metav1.GetOptions{})
+				template = deployment.Spec.Template
+			} else {
+				statefulSet, _ := kubeClient.AppsV1().StatefulSets("databases").Get(context.Background(), response.ID, metav1.GetOptions{})
+				template = statefulSet.Spec.Template
+			}
+			if podSecurity := template.Spec.SecurityContext; podSecurity == nil || *podSecurity.RunAsUser != postgresUID || !*podSecurity.RunAsNonRoot {
+				t.Errorf("expected the pods to run as the postgres user, got %v", podSecurity)
+			}
+			ownership := template.Spec.InitContainers[0]
+			if ownership.Name != volumeOwnershipContainer {
+				t.Fatalf("expected %s to be the first init container, got %s", volumeOwnershipContainer, ownership.Name)
+			}
+			expectedCommand := []string{"chown", "-R", "999:999", "/var/lib/postgresql/data"}
+			if diff := cmp.Diff(expectedCommand, ownership.Command); diff != "" {
+				t.Errorf("command has diff %s", diff)
+			}
+			if security := ownership.SecurityContext; *security.RunAsUser != 0 || *security.AllowPrivilegeEscalation || security.Capabilities.Drop[0] != "ALL" {
+				t.Errorf("expected %s to run as root without privilege escalation, got %v", volumeOwnershipContainer, security)
+			}
+			for _, container := range append(template.Spec.InitContainers[1:], template.Spec.Containers...) {
+				if security := container.SecurityContext; security == nil || len(security.Capabilities.Add) != 0 {
+					t.Errorf("expected container %s to drop every capability, got %v", container.Name, security)
+				}
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create with allowed clients
+func TestPostgresNetworkPolicy(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	allowedClients := models.AllowedClients{
+		NamespaceSelectors: []string{"team=payments"},
+		PodSelectors:       []string{"app in (api,worker)"},
+		CIDRs:              []string{"10.0.0.0/8"},
+	}
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce", AllowedClients: allowedClients})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	networkPolicy, err := kubeClient.NetworkingV1().NetworkPolicies(metav1.NamespaceDefault).Get(context.Background(), postgresNetworkPolicyPrefix+response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected network policy to be created, got error %v", err)
+	}
+	if diff := cmp.Diff(selectorLabels(response.ID), networkPolicy.Spec.PodSelector.MatchLabels); diff != "" {
+		t.Errorf("pod selector has diff %s", diff)
+	}
+	peers := networkPolicy.Spec.Ingress[0].From
+	// The pods of the instance come first, so standbys reach the primary
+	if len(peers) != 4 || peers[0].PodSelector.MatchLabels[labelInstance] != response.ID ||
+		peers[1].NamespaceSelector.MatchLabels["team"] != "payments" ||
+		peers[2].PodSelector.MatchExpressions[0].Key != "app" ||
+		peers[3].IPBlock.CIDR != "10.0.0.0/8" {
+		t.Errorf("unexpected ingress peers %v", peers)
+	}
+	// WHEN port is updated THEN the policy allows the new port
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathPortNum}, PortNum: 5433}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	networkPolicy, _ = kubeClient.NetworkingV1().NetworkPolicies(metav1.NamespaceDefault).Get(context.Background(), postgresNetworkPolicyPrefix+response.ID, metav1.GetOptions{})
+	if port := networkPolicy.Spec.Ingress[0].Ports[0].Port.IntValue(); port != 5433 {
+		t.Errorf("expected policy port = 5433, received = %d", port)
+	}
+	// WHEN instance is deleted THEN the policy is deleted
+	if _, err := postgres.Delete(context.Background(), models.DeleteRequest{ID: response.ID}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	networkPolicies, _ := kubeClient.NetworkingV1().NetworkPolicies(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	if len(networkPolicies.Items) != 0 {
+		t.Errorf("expected no network policy left, got %d", len(networkPolicies.Items))
+	}
+}
+
+// GIVEN Postgres Create with scheduling options
+func TestPostgresScheduling(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	scheduling := models.Scheduling{
+		NodeSelector:   map[string]string{"pool": "databases"},
+		Tolerations:    []models.Toleration{{Key: "dedicated", Value: "databases", Effect: "NoSchedule"}},
+		AntiAffinity:   models.AntiAffinity{Topology: "node", Required: true},
+		TopologySpread: []models.TopologySpread{{Topology: "zone", MaxSkew: 1, WhenUnsatisfiable: "DoNotSchedule"}},
+	}
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 3, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Scheduling: scheduling})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	spec := statefulSet.Spec.Template.Spec
+	if spec.NodeSelector["pool"] != "databases" || len(spec.Tolerations) != 1 || spec.Tolerations[0].Effect != apiv1.TaintEffectNoSchedule {
+		t.Errorf("unexpected node selection %v %v", spec.NodeSelector, spec.Tolerations)
+	}
+	terms := spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || terms[0].TopologyKey != apiv1.LabelHostname || terms[0].LabelSelector.MatchLabels[labelInstance] != response.ID {
+		t.Errorf("unexpected anti-affinity %v", terms)
+	}
+	if len(spec.TopologySpreadConstraints) != 1 || spec.TopologySpreadConstraints[0].TopologyKey != apiv1.LabelTopologyZone || spec.TopologySpreadConstraints[0].WhenUnsatisfiable != apiv1.DoNotSchedule {
+		t.Errorf("unexpected topology spread %v", spec.TopologySpreadConstraints)
+	}
+	podDisruptionBudget, err := kubeClient.PolicyV1().PodDisruptionBudgets(metav1.NamespaceDefault).Get(context.Background(), postgresDisruptionBudgetPrefix+response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected pod disruption budget to be created, got error %v", err)
+	}
+	if podDisruptionBudget.Spec.MinAvailable.IntValue() != 2 || podDisruptionBudget.Spec.MaxUnavailable != nil || podDisruptionBudget.Spec.Selector.MatchLabels[labelInstance] != response.ID {
+		t.Errorf("unexpected pod disruption budget spec %v", podDisruptionBudget.Spec)
+	}
+	// WHEN instance is scaled down to a single replica THEN a drain can evict its pod
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathReplicas}, Replicas: 1}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	podDisruptionBudget, _ = kubeClient.PolicyV1().PodDisruptionBudgets(metav1.NamespaceDefault).Get(context.Background(), postgresDisruptionBudgetPrefix+response.ID, metav1.GetOptions{})
+	if podDisruptionBudget.Spec.MaxUnavailable == nil || podDisruptionBudget.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Errorf("expected max unavailable = 1, received = %v", podDisruptionBudget.Spec.MaxUnavailable)
+	}
+	// WHEN instance is deleted THEN the disruption budget is deleted
+	if _, err := postgres.Delete(context.Background(), models.DeleteRequest{ID: response.ID}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	podDisruptionBudgets, _ := kubeClient.PolicyV1().PodDisruptionBudgets(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	if len(podDisruptionBudgets.Items) != 0 {
+		t.Errorf("expected no pod disruption budget left, got %d", len(podDisruptionBudgets.Items))
+	}
+}
+
+// GIVEN the disruption budget of an instance
+func TestPodDisruptionBudget(t *testing.T) {
+	tcs := []struct {
+		description    string
+		replicas       int32
+		minAvailable   int // Unset when 0
+		maxUnavailable int // Unset when 0
+	}{
+		{
+			description:    "WHEN the instance has a single replica THEN its pod can be evicted",
+			replicas:       1,
+			maxUnavailable: 1,
+		},
+		{
+			description:  "WHEN the instance has two replicas THEN one of them is kept",
+			replicas:     2,
+			minAvailable: 1,
+		},
+		{
+			description:  "WHEN the instance has three replicas THEN all but one are kept",
+			replicas:     3,
+			minAvailable: 2,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			spec := setPodDisruptionBudget(tc.replicas, "id").Spec
+			if (spec.MinAvailable == nil) != (tc.minAvailable == 0) || (spec.MinAvailable != nil && spec.MinAvailable.IntValue() != tc.minAvailable) {
+				t.Errorf("expected min available = %v, received = %v", tc.minAvailable, spec.MinAvailable)
+			}
+			if (spec.MaxUnavailable == nil) != (tc.maxUnavailable == 0) || (spec.MaxUnavailable != nil && spec.MaxUnavailable.IntValue() != tc.maxUnavailable) {
+				t.Errorf("expected max unavailable = %v, received = %v", tc.maxUnavailable, spec.MaxUnavailable)
+			}
+		})
+	}
+}
+
+// GIVEN Postgres Create and Delete with owner references
+func TestPostgresOwnerReferences(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// WHEN instance is created THEN its objects are owned by the StatefulSet
+	secret, _ := kubeClient.CoreV1().Secrets(metav1.NamespaceDefault).Get(context.Background(), postgresCredentialsPrefix+response.ID, metav1.GetOptions{})
+	service, _ := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Get(context.Background(), postgresReadOnlyPrefix+response.ID, metav1.GetOptions{})
+	for _, object := range []metav1.Object{secret, service} {
+		owners := object.GetOwnerReferences()
+		if len(owners) != 1 || owners[0].Kind != "StatefulSet" || owners[0].Name != response.ID {
+			t.Errorf("expected %s to be owned by the statefulset, got %v", object.GetName(), owners)
+		}
+	}
+	// WHEN an object fails to be deleted THEN the others are still deleted and the failure reported
+	if err := kubeClient.CoreV1().Services(metav1.NamespaceDefault).Delete(context.Background(), postgresPrefix+response.ID, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	kubeClient.PrependReactor("delete", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("etcdserver: request timed out")
+	})
+	deleted, err := postgres.Delete(context.Background(), models.DeleteRequest{ID: response.ID})
+	expectedErr := fmt.Errorf(deleteObjectError, "Secret", postgresCredentialsPrefix+response.ID, errors.New("etcdserver: request timed out"))
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error = %v, received error = %v", expectedErr, err)
+	}
+	results := map[string]models.DeleteResult{}
+	for _, object := range deleted.Objects {
+		results[object.Kind+"/"+object.Name] = object.Result
+	}
+	expectedResults := map[string]models.DeleteResult{
+		"StatefulSet/" + response.ID:                                    models.DeleteResultDeleted,
+		"Service/" + postgresPrefix + response.ID:                       models.DeleteResultNotFound,
+		"ConfigMap/" + postgresConfigMapPrefix + response.ID:            models.DeleteResultDeleted,
+		"Secret/" + postgresCredentialsPrefix + response.ID:             models.DeleteResultFailed,
+		"PersistentVolume/" + postgresVolumePrefix + response.ID + "-1": models.DeleteResultDeleted,
+	}
+	for name, expected := range expectedResults {
+		if results[name] != expected {
+			t.Errorf("expected %s result = %s, received = %s", name, expected, results[name])
+		}
+	}
+	// WHEN delete is retried THEN only the failed object is left to delete
+	kubeClient.ReactionChain = kubeClient.ReactionChain[1:]
+	deleted, err = postgres.Delete(context.Background(), models.DeleteRequest{ID: response.ID})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, object := range deleted.Objects {
+		expected := models.DeleteResultNotFound
+		if object.Kind == "Secret" {
+			expected = models.DeleteResultDeleted
+		}
+		if object.Result != expected {
+			t.Errorf("expected %s %s result = %s, received = %s", object.Kind, object.Name, expected, object.Result)
+		}
+	}
+}
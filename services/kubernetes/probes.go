@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"schwarz/models"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultProbePeriodSeconds    = 10
+	defaultProbeTimeoutSeconds   = 5
+	defaultProbeFailureThreshold = 3
+	// initdb and pg_basebackup of a large primary run before the server accepts connections
+	defaultStartupTimeoutSeconds = 300
+
+	// PGPORT is only set on pods created with it, older ones listen on the image default
+	pgIsReadyCommand = `pg_isready -h 127.0.0.1 -p "${PGPORT:-5432}" -U "$POSTGRES_USER"`
+)
+
+// withDefaultProbes fills the probe settings not requested with the defaults
+func withDefaultProbes(probes models.Probes) models.Probes {
+	if probes.PeriodSeconds == 0 {
+		probes.PeriodSeconds = defaultProbePeriodSeconds
+	}
+	if probes.TimeoutSeconds == 0 {
+		probes.TimeoutSeconds = defaultProbeTimeoutSeconds
+	}
+	if probes.FailureThreshold == 0 {
+		probes.FailureThreshold = defaultProbeFailureThreshold
+	}
+	if probes.StartupTimeoutSeconds == 0 {
+		probes.StartupTimeoutSeconds = defaultStartupTimeoutSeconds
+	}
+	return probes
+}
+
+// setProbes checks the postgres container with pg_isready. The startup probe holds the liveness
+// and readiness ones until the server first accepts connections, so a long initdb is not restarted.
+func setProbes(template *apiv1.PodTemplateSpec, probes models.Probes) {
+	if len(template.Spec.Containers) == 0 {
+		return
+	}
+	probes = withDefaultProbes(probes)
+	container := &template.Spec.Containers[0]
+	container.StartupProbe = pgIsReadyProbe(probes)
+	// Round up so the server gets at least the whole startup timeout
+	container.StartupProbe.FailureThreshold = (probes.StartupTimeoutSeconds + probes.PeriodSeconds - 1) / probes.PeriodSeconds
+	container.ReadinessProbe = pgIsReadyProbe(probes)
+	container.LivenessProbe = pgIsReadyProbe(probes)
+}
+
+func pgIsReadyProbe(probes models.Probes) *apiv1.Probe {
+	return &apiv1.Probe{
+		ProbeHandler: apiv1.ProbeHandler{
+			Exec: &apiv1.ExecAction{
+				Command: []string{"sh", "-c", pgIsReadyCommand},
+			},
+		},
+		PeriodSeconds:    probes.PeriodSeconds,
+		TimeoutSeconds:   probes.TimeoutSeconds,
+		FailureThreshold: probes.FailureThreshold,
+		SuccessThreshold: 1,
+	}
+}
+
+// getProbes returns the settings of the probes of the postgres container, empty for pods created without them
+func getProbes(template *apiv1.PodTemplateSpec) models.Probes {
+	var probes models.Probes
+	if len(template.Spec.Containers) == 0 || template.Spec.Containers[0].LivenessProbe == nil {
+		return probes
+	}
+	container := template.Spec.Containers[0]
+	probes.PeriodSeconds = container.LivenessProbe.PeriodSeconds
+	probes.TimeoutSeconds = container.LivenessProbe.TimeoutSeconds
+	probes.FailureThreshold = container.LivenessProbe.FailureThreshold
+	if container.StartupProbe != nil {
+		probes.StartupTimeoutSeconds = container.StartupProbe.FailureThreshold * container.StartupProbe.PeriodSeconds
+	}
+	return probes
+}
@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"schwarz/models"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	postgresReadOnlyPrefix    = "postgres-ro-"
+	postgresReplicationPrefix = "postgres-replication-"
+
+	envPostgresReplicationUser     = "POSTGRES_REPLICATION_USER"
+	envPostgresReplicationPassword = "POSTGRES_REPLICATION_PASSWORD"
+	envPGPort                      = "PGPORT"
+	envPrimaryHost                 = "PRIMARY_HOST"
+
+	replicationUser           = "replicator"
+	replicationPasswordLength = 24
+	replicationVolume         = "replication"
+	replicationMountPath      = "/replication"
+	initdbMountPath           = "/docker-entrypoint-initdb.d"
+	scriptInitPrimary         = "10-replication.sh"
+	scriptStandby             = "standby.sh"
+)
+
+// initPrimaryScript runs once on the primary, when the postgres image initializes its data
+// directory, creating the role used by standbys to stream the WAL.
+const initPrimaryScript = `#!/bin/bash
+set -e
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" \
+	--set user="$POSTGRES_REPLICATION_USER" --set pass="$POSTGRES_REPLICATION_PASSWORD" <<-'EOSQL'
+	CREATE ROLE :"user" WITH REPLICATION LOGIN PASSWORD :'pass';
+EOSQL
+echo "host replication $POSTGRES_REPLICATION_USER all scram-sha-256" >> "$PGDATA/pg_hba.conf"
+`
+
+// standbyScript runs as init container on every pod. Pods other than the first one clone the
+// primary into an empty data directory and are configured as hot standbys streaming from it. The
+// connection to the primary is written again on every start, so it follows port updates.
+const standbyScript = `#!/bin/bash
+set -e
+if [ "${HOSTNAME##*-}" = "0" ]; then
+	exit 0
+fi
+if [ ! -s "$PGDATA/PG_VERSION" ]; then
+	export PGPASSWORD="$POSTGRES_REPLICATION_PASSWORD"
+	until pg_isready --host "$PRIMARY_HOST" --port "$PGPORT"; do
+		sleep 2
+	done
+	pg_basebackup --host "$PRIMARY_HOST" --port "$PGPORT" --username "$POSTGRES_REPLICATION_USER" \
+		--pgdata "$PGDATA" --wal-method stream
+	touch "$PGDATA/standby.signal"
+fi
+sed -i '/^primary_conninfo/d' "$PGDATA/postgresql.auto.conf"
+echo "primary_conninfo = 'host=$PRIMARY_HOST port=$PGPORT user=$POSTGRES_REPLICATION_USER password=$POSTGRES_REPLICATION_PASSWORD application_name=$HOSTNAME'" \
+	>> "$PGDATA/postgresql.auto.conf"
+`
+
+// primaryPodName returns the name of the StatefulSet pod running the primary
+func primaryPodName(id string) string {
+	return id + "-0"
+}
+
+// primaryHost returns the stable DNS name of the primary given by the headless Service
+func primaryHost(id string) string {
+	return fmt.Sprintf("%s.%s%s", primaryPodName(id), postgresHeadlessPrefix, id)
+}
+
+// podRole tells the primary of a StatefulSet apart from its standbys. Pods of a Deployment
+// don't replicate, they share the same volume.
+func podRole(workload *workload, pod *apiv1.Pod) models.PodRole {
+	switch {
+	case workload.kind != workloadStatefulSet:
+		return models.RoleStandalone
+	case pod.Name == primaryPodName(workload.name):
+		return models.RolePrimary
+	default:
+		return models.RoleReplica
+	}
+}
+
+func getPodStatus(workload *workload, pod *apiv1.Pod) models.PodStatus {
+	status := models.PodStatus{
+		Name: pod.Name,
+		Role: podRole(workload, pod),
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodReady {
+			status.Ready = condition.Status == apiv1.ConditionTrue
+		}
+	}
+	return status
+}
+
+// replicationPassword generates the password of the replication role, which is never returned to clients
+func replicationPassword() []byte {
+	data := make([]byte, replicationPasswordLength/2)
+	_, _ = rand.Read(data)
+	return []byte(hex.EncodeToString(data))
+}
+
+// replicationEnv returns the container environment used to set up replication
+func replicationEnv(port int32, id string) []apiv1.EnvVar {
+	env := []apiv1.EnvVar{
+		{Name: envPGPort, Value: fmt.Sprint(port)},
+		{Name: envPrimaryHost, Value: primaryHost(id)},
+	}
+	for _, key := range []string{envPostgresReplicationUser, envPostgresReplicationPassword} {
+		env = append(env, apiv1.EnvVar{
+			Name: key,
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{
+						Name: postgresCredentialsPrefix + id,
+					},
+					Key: key,
+				},
+			},
+		})
+	}
+	return env
+}
+
+func setReplicationConfigMap(id string) *apiv1.ConfigMap {
+	labelData := instanceLabels(id, componentConfig)
+	scriptData := map[string]string{
+		scriptInitPrimary: initPrimaryScript,
+		scriptStandby:     standbyScript,
+	}
+	return &apiv1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   postgresReplicationPrefix + id,
+			Labels: labelData,
+		},
+		Data: scriptData,
+	}
+}
+
+// setReplication configures the pods of a StatefulSet for streaming replication, cloning the
+// primary from an init container before postgres starts on standbys.
+func setReplication(template *apiv1.PodTemplateSpec, port int32, id string) {
+	scriptMode := int32(0o555)
+	template.Spec.Volumes = append(template.Spec.Volumes, apiv1.Volume{
+		Name: replicationVolume,
+		VolumeSource: apiv1.VolumeSource{
+			ConfigMap: &apiv1.ConfigMapVolumeSource{
+				LocalObjectReference: apiv1.LocalObjectReference{
+					Name: postgresReplicationPrefix + id,
+				},
+				DefaultMode: &scriptMode,
+			},
+		},
+	})
+	container := &template.Spec.Containers[0]
+	container.Env = append(container.Env, replicationEnv(port, id)...)
+	container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+		Name:      replicationVolume,
+		MountPath: initdbMountPath + "/" + scriptInitPrimary,
+		SubPath:   scriptInitPrimary,
+	})
+	template.Spec.InitContainers = []apiv1.Container{{
+		Name:            "standby",
+		Image:           container.Image,
+		ImagePullPolicy: container.ImagePullPolicy,
+		Command:         []string{replicationMountPath + "/" + scriptStandby},
+		Env:             replicationEnv(port, id),
+		VolumeMounts: []apiv1.VolumeMount{
+			{
+				Name:      postgresDataVolume,
+				MountPath: "/var/lib/postgresql/data",
+			},
+			{
+				Name:      replicationVolume,
+				MountPath: replicationMountPath,
+			},
+		},
+	}}
+}
+
+// setPrimaryService narrows the selector of the read-write Service to the primary pod
+func setPrimaryService(service *apiv1.Service, id string) {
+	service.Spec.Selector[appsv1.StatefulSetPodNameLabel] = primaryPodName(id)
+}
+
+// setReadOnlyService load balances reads over every pod, hot standbys and primary alike, since
+// selectors cannot exclude a single pod of the StatefulSet.
+func setReadOnlyService(port int32, id string) *apiv1.Service {
+	service := setService(port, id)
+	service.Name = postgresReadOnlyPrefix + id
+	return service
+}
@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"context"
+	"schwarz/models"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GIVEN getPodStatus
+func TestGetPodStatus(t *testing.T) {
+	id := "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b"
+	ready := []apiv1.PodCondition{{Type: apiv1.PodReady, Status: apiv1.ConditionTrue}}
+	tcs := []struct {
+		description string
+		workload    *workload
+		pod         *apiv1.Pod
+		expected    models.PodStatus
+	}{
+		{
+			description: "WHEN pod is the first of a StatefulSet THEN role is primary",
+			workload:    &workload{kind: workloadStatefulSet, name: id},
+			pod:         &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: id + "-0"}, Status: apiv1.PodStatus{Conditions: ready}},
+			expected:    models.PodStatus{Name: id + "-0", Role: models.RolePrimary, Ready: true},
+		},
+		{
+			description: "WHEN pod is not the first of a StatefulSet THEN role is replica",
+			workload:    &workload{kind: workloadStatefulSet, name: id},
+			pod:         &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: id + "-10"}},
+			expected:    models.PodStatus{Name: id + "-10", Role: models.RoleReplica},
+		},
+		{
+			description: "WHEN pod belongs to a Deployment THEN role is standalone",
+			workload:    &workload{kind: workloadDeployment, name: id},
+			pod:         &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: id + "-7d4b9c-x2z8q"}, Status: apiv1.PodStatus{Conditions: ready}},
+			expected:    models.PodStatus{Name: id + "-7d4b9c-x2z8q", Role: models.RoleStandalone, Ready: true},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			if status := getPodStatus(tc.workload, tc.pod); status != tc.expected {
+				t.Errorf("expected status = %v, received = %v", tc.expected, status)
+			}
+		})
+	}
+}
+
+// GIVEN a replicated instance with standbys set up by the previous standby script
+func TestReplicationPortUpdate(t *testing.T) {
+	kubeClient := newFakeClientset()
+	postgres := NewPostgres(kubeClient, newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", PortNum: 5432, Replicas: 2, Capacity: "10Mi", AccessMode: "ReadWriteOnce"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	configMaps := kubeClient.CoreV1().ConfigMaps(metav1.NamespaceDefault)
+	configMap, err := configMaps.Get(context.Background(), postgresReplicationPrefix+response.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	configMap.Data[scriptStandby] = "#!/bin/bash"
+	if _, err := configMaps.Update(context.Background(), configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// WHEN the port is updated THEN the standbys connect to the primary on the new port on their next start
+	if err := postgres.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathPortNum}, PortNum: 5433}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	configMap, _ = configMaps.Get(context.Background(), postgresReplicationPrefix+response.ID, metav1.GetOptions{})
+	if configMap.Data[scriptStandby] != standbyScript {
+		t.Errorf("expected the standby script to be applied again, got %s", configMap.Data[scriptStandby])
+	}
+	if !strings.Contains(standbyScript, "sed -i '/^primary_conninfo/d'") {
+		t.Errorf("expected the standby script to write primary_conninfo again on every start")
+	}
+	statefulSet, _ := kubeClient.AppsV1().StatefulSets(metav1.NamespaceDefault).Get(context.Background(), response.ID, metav1.GetOptions{})
+	for _, container := range statefulSet.Spec.Template.Spec.InitContainers {
+		for _, env := range container.Env {
+			if env.Name == envPGPort && env.Value != "5433" {
+				t.Errorf("expected init container %s %s = 5433, received = %s", container.Name, envPGPort, env.Value)
+			}
+		}
+	}
+}
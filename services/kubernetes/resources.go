@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"schwarz/models"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+const (
+	updatePathResources     = "resources"
+	updatePathCPURequest    = "resources.cpu_request"
+	updatePathCPULimit      = "resources.cpu_limit"
+	updatePathMemoryRequest = "resources.memory_request"
+	updatePathMemoryLimit   = "resources.memory_limit"
+)
+
+// resourcePaths are the update paths changing the resources of the pods
+var resourcePaths = []string{updatePathResources, updatePathCPURequest, updatePathCPULimit, updatePathMemoryRequest, updatePathMemoryLimit}
+
+// withDefaultResources fills the quantities not requested with the service defaults
+func withDefaultResources(resources, defaults models.Resources) models.Resources {
+	if resources.CPURequest == "" {
+		resources.CPURequest = defaults.CPURequest
+	}
+	if resources.CPULimit == "" {
+		resources.CPULimit = defaults.CPULimit
+	}
+	if resources.MemoryRequest == "" {
+		resources.MemoryRequest = defaults.MemoryRequest
+	}
+	if resources.MemoryLimit == "" {
+		resources.MemoryLimit = defaults.MemoryLimit
+	}
+	return resources
+}
+
+// setResources applies the quantities to every container of the pod template, empty ones are left unset
+func setResources(template *apiv1.PodTemplateSpec, resources models.Resources) {
+	for _, containers := range [][]apiv1.Container{template.Spec.InitContainers, template.Spec.Containers} {
+		for idx := range containers {
+			requirements := &containers[idx].Resources
+			setQuantity(&requirements.Requests, apiv1.ResourceCPU, resources.CPURequest)
+			setQuantity(&requirements.Limits, apiv1.ResourceCPU, resources.CPULimit)
+			setQuantity(&requirements.Requests, apiv1.ResourceMemory, resources.MemoryRequest)
+			setQuantity(&requirements.Limits, apiv1.ResourceMemory, resources.MemoryLimit)
+		}
+	}
+}
+
+// applyResources returns the requirements of a container with the quantities, empty ones are left unset
+func applyResources(resources models.Resources) *corev1ac.ResourceRequirementsApplyConfiguration {
+	var requirements apiv1.ResourceRequirements
+	setQuantity(&requirements.Requests, apiv1.ResourceCPU, resources.CPURequest)
+	setQuantity(&requirements.Limits, apiv1.ResourceCPU, resources.CPULimit)
+	setQuantity(&requirements.Requests, apiv1.ResourceMemory, resources.MemoryRequest)
+	setQuantity(&requirements.Limits, apiv1.ResourceMemory, resources.MemoryLimit)
+	config := corev1ac.ResourceRequirements()
+	if len(requirements.Requests) > 0 {
+		config.WithRequests(requirements.Requests)
+	}
+	if len(requirements.Limits) > 0 {
+		config.WithLimits(requirements.Limits)
+	}
+	return config
+}
+
+func setQuantity(list *apiv1.ResourceList, name apiv1.ResourceName, quantity string) {
+	if quantity == "" {
+		delete(*list, name)
+		return
+	}
+	if *list == nil {
+		*list = apiv1.ResourceList{}
+	}
+	(*list)[name] = resource.MustParse(quantity)
+}
+
+// getResources returns the quantities of the postgres container
+func getResources(template *apiv1.PodTemplateSpec) models.Resources {
+	var resources models.Resources
+	if len(template.Spec.Containers) == 0 {
+		return resources
+	}
+	requirements := template.Spec.Containers[0].Resources
+	if quantity, ok := requirements.Requests[apiv1.ResourceCPU]; ok {
+		resources.CPURequest = quantity.String()
+	}
+	if quantity, ok := requirements.Limits[apiv1.ResourceCPU]; ok {
+		resources.CPULimit = quantity.String()
+	}
+	if quantity, ok := requirements.Requests[apiv1.ResourceMemory]; ok {
+		resources.MemoryRequest = quantity.String()
+	}
+	if quantity, ok := requirements.Limits[apiv1.ResourceMemory]; ok {
+		resources.MemoryLimit = quantity.String()
+	}
+	return resources
+}
+
+// maskedResources returns the current quantities with the masked ones replaced by the requested ones
+func maskedResources(resources, requested models.Resources, paths func(...string) bool) models.Resources {
+	if paths(updatePathResources, updatePathCPURequest) {
+		resources.CPURequest = requested.CPURequest
+	}
+	if paths(updatePathResources, updatePathCPULimit) {
+		resources.CPULimit = requested.CPULimit
+	}
+	if paths(updatePathResources, updatePathMemoryRequest) {
+		resources.MemoryRequest = requested.MemoryRequest
+	}
+	if paths(updatePathResources, updatePathMemoryLimit) {
+		resources.MemoryLimit = requested.MemoryLimit
+	}
+	return resources
+}
@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"schwarz/models"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	postgresDisruptionBudgetPrefix = "postgres-pdb-"
+	stepPodDisruptionBudget        = "poddisruptionbudget"
+
+	topologyNode = "node"
+	topologyZone = "zone"
+)
+
+// topologyKeys are the well-known node labels of each topology
+var topologyKeys = map[string]string{
+	topologyNode: apiv1.LabelHostname,
+	topologyZone: apiv1.LabelTopologyZone,
+}
+
+// setScheduling places the pods of an instance on the nodes, spreading its replicas
+func setScheduling(template *apiv1.PodTemplateSpec, scheduling models.Scheduling, id string) {
+	spec := &template.Spec
+	if len(scheduling.NodeSelector) > 0 {
+		spec.NodeSelector = scheduling.NodeSelector
+	}
+	for _, toleration := range scheduling.Tolerations {
+		spec.Tolerations = append(spec.Tolerations, apiv1.Toleration{
+			Key:      toleration.Key,
+			Operator: apiv1.TolerationOperator(toleration.Operator),
+			Value:    toleration.Value,
+			Effect:   apiv1.TaintEffect(toleration.Effect),
+		})
+	}
+	replicaSelector := &metav1.LabelSelector{MatchLabels: selectorLabels(id)}
+	if topologyKey, ok := topologyKeys[strings.ToLower(scheduling.AntiAffinity.Topology)]; ok {
+		term := apiv1.PodAffinityTerm{
+			LabelSelector: replicaSelector,
+			TopologyKey:   topologyKey,
+		}
+		antiAffinity := &apiv1.PodAntiAffinity{}
+		if scheduling.AntiAffinity.Required {
+			antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = []apiv1.PodAffinityTerm{term}
+		} else {
+			antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []apiv1.WeightedPodAffinityTerm{{
+				Weight:          100,
+				PodAffinityTerm: term,
+			}}
+		}
+		spec.Affinity = &apiv1.Affinity{PodAntiAffinity: antiAffinity}
+	}
+	for _, spread := range scheduling.TopologySpread {
+		whenUnsatisfiable := apiv1.ScheduleAnyway
+		if strings.EqualFold(spread.WhenUnsatisfiable, string(apiv1.DoNotSchedule)) {
+			whenUnsatisfiable = apiv1.DoNotSchedule
+		}
+		spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, apiv1.TopologySpreadConstraint{
+			MaxSkew:           spread.MaxSkew,
+			TopologyKey:       topologyKeys[strings.ToLower(spread.Topology)],
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     replicaSelector,
+		})
+	}
+}
+
+// setPodDisruptionBudget lets voluntary disruptions, such as node drains, evict a single pod of
+// the instance at a time. The pod of a single replica instance is evicted too, so drains and
+// cluster upgrades don't hang on it, at the cost of the instance being down until it is rescheduled.
+func setPodDisruptionBudget(replicas int32, id string) *policyv1.PodDisruptionBudget {
+	podDisruptionBudget := &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   postgresDisruptionBudgetPrefix + id,
+			Labels: instanceLabels(id, componentDatabase),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selectorLabels(id)},
+		},
+	}
+	if replicas > 1 {
+		minAvailable := intstr.FromInt32(replicas - 1)
+		podDisruptionBudget.Spec.MinAvailable = &minAvailable
+	} else {
+		maxUnavailable := intstr.FromInt32(1)
+		podDisruptionBudget.Spec.MaxUnavailable = &maxUnavailable
+	}
+	return podDisruptionBudget
+}
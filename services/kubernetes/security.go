@@ -0,0 +1,134 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// UID and GID of the postgres user in the Debian based postgres images
+	postgresUID = 999
+
+	// The image initializes PGDATA, a subdirectory since a non-root server can't own the volume root
+	envPGData  = "PGDATA"
+	pgDataPath = "/var/lib/postgresql/data/pgdata"
+
+	// https://kubernetes.io/docs/concepts/security/pod-security-admission
+	labelPodSecurityEnforce  = "pod-security.kubernetes.io/enforce"
+	podSecurityPrivileged    = "privileged"
+	podSecurityBaseline      = "baseline"
+	podSecurityRestricted    = "restricted"
+	podSecurityLevelError    = "namespace %s enforces unknown Pod Security level %s"
+	podSecurityMinLevelError = "namespace %s enforces Pod Security level %s, at least %s is required"
+	podSecurityHostPathError = "namespace %s enforces Pod Security level %s, hostPath storage needs at most %s"
+
+	volumeOwnershipContainer = "volume-ownership"
+)
+
+// podSecurityLevels ranks the Pod Security Standards from the least to the most restrictive
+var podSecurityLevels = map[string]int{
+	podSecurityPrivileged: 0,
+	podSecurityBaseline:   1,
+	podSecurityRestricted: 2,
+}
+
+// checkPodSecurity verifies the Pod Security admission level of the namespace before any object
+// is created in it. Namespaces without the label enforce the cluster default, privileged unless
+// the admission configuration says otherwise. Pods on hostPath storage run their first init
+// container as root, which the restricted level doesn't admit.
+func (s *Postgres) checkPodSecurity(ctx context.Context, namespace string, hostPath bool) error {
+	result, err := s.kubeClient.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		// Missing namespaces are reported when the first object is created
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	level, set := result.Labels[labelPodSecurityEnforce]
+	if !set {
+		level = podSecurityPrivileged
+	}
+	rank, ok := podSecurityLevels[level]
+	if !ok {
+		return fmt.Errorf(podSecurityLevelError, namespace, level)
+	}
+	if s.config.MinPodSecurityLevel != "" && rank < podSecurityLevels[s.config.MinPodSecurityLevel] {
+		return fmt.Errorf(podSecurityMinLevelError, namespace, level, s.config.MinPodSecurityLevel)
+	}
+	if hostPath && rank > podSecurityLevels[podSecurityBaseline] {
+		return fmt.Errorf(podSecurityHostPathError, namespace, level, podSecurityBaseline)
+	}
+	return nil
+}
+
+// setPodSecurity makes the pods comply with the restricted Pod Security Standard, so they are
+// admitted by namespaces enforcing any level. Pods on hostPath storage comply with the baseline one.
+func setPodSecurity(template *apiv1.PodTemplateSpec, hostPath bool) {
+	uid := int64(postgresUID)
+	runAsNonRoot := true
+	template.Spec.SecurityContext = &apiv1.PodSecurityContext{
+		RunAsUser:    &uid,
+		RunAsGroup:   &uid,
+		RunAsNonRoot: &runAsNonRoot,
+		// The data volume is made writable by the postgres group, hostPath volumes are left as they are
+		FSGroup: &uid,
+		SeccompProfile: &apiv1.SeccompProfile{
+			Type: apiv1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+	for _, containers := range [][]apiv1.Container{template.Spec.InitContainers, template.Spec.Containers} {
+		for idx := range containers {
+			allowPrivilegeEscalation := false
+			containers[idx].SecurityContext = &apiv1.SecurityContext{
+				AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+				Capabilities: &apiv1.Capabilities{
+					Drop: []apiv1.Capability{"ALL"},
+				},
+			}
+			containers[idx].Env = append(containers[idx].Env, apiv1.EnvVar{Name: envPGData, Value: pgDataPath})
+		}
+	}
+	if hostPath {
+		setVolumeOwnership(template)
+	}
+}
+
+// setVolumeOwnership gives the data volume to the postgres user before the other containers start.
+// The kubelet applies the fsGroup to provisioned volumes but leaves hostPath ones owned by root, so
+// this init container runs as root, only with the capabilities chown needs.
+func setVolumeOwnership(template *apiv1.PodTemplateSpec) {
+	var mounts []apiv1.VolumeMount
+	for _, mount := range template.Spec.Containers[0].VolumeMounts {
+		if mount.Name == postgresDataVolume {
+			mounts = append(mounts, mount)
+		}
+	}
+	if len(mounts) == 0 {
+		return
+	}
+	root := int64(0)
+	runAsNonRoot := false
+	allowPrivilegeEscalation := false
+	container := apiv1.Container{
+		Name:         volumeOwnershipContainer,
+		Command:      []string{"chown", "-R", fmt.Sprintf("%d:%d", postgresUID, postgresUID), mounts[0].MountPath},
+		VolumeMounts: mounts,
+		Resources:    template.Spec.Containers[0].Resources,
+		SecurityContext: &apiv1.SecurityContext{
+			RunAsUser:                &root,
+			RunAsGroup:               &root,
+			RunAsNonRoot:             &runAsNonRoot,
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			Capabilities: &apiv1.Capabilities{
+				Drop: []apiv1.Capability{"ALL"},
+				Add:  []apiv1.Capability{"CHOWN", "DAC_OVERRIDE", "FOWNER"},
+			},
+		},
+	}
+	template.Spec.InitContainers = append([]apiv1.Container{container}, template.Spec.InitContainers...)
+}
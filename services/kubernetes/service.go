@@ -7,8 +7,12 @@ import (
 
 type Service interface {
 	Create(ctx context.Context, request models.CreateRequest) (models.CreateResponse, error)
+	Get(ctx context.Context, request models.GetRequest) (models.GetResponse, error)
+	List(ctx context.Context, request models.ListRequest) (models.ListResponse, error)
+	Watch(ctx context.Context, request models.WatchRequest) (<-chan models.WatchEvent, error)
 	Update(ctx context.Context, request models.UpdateRequest) error
-	Delete(ctx context.Context, request models.DeleteRequest) error
+	Delete(ctx context.Context, request models.DeleteRequest) (models.DeleteResponse, error)
+	Drift(ctx context.Context, request models.DriftRequest) (models.DriftResponse, error)
 }
 
 type DefaultService struct{}
@@ -21,10 +25,28 @@ func (d *DefaultService) Create(context.Context, models.CreateRequest) (models.C
 	return models.CreateResponse{}, nil
 }
 
-func (d *DefaultService) Delete(context.Context, models.DeleteRequest) error {
-	return nil
+func (d *DefaultService) Get(context.Context, models.GetRequest) (models.GetResponse, error) {
+	return models.GetResponse{}, nil
+}
+
+func (d *DefaultService) List(context.Context, models.ListRequest) (models.ListResponse, error) {
+	return models.ListResponse{}, nil
+}
+
+func (d *DefaultService) Watch(context.Context, models.WatchRequest) (<-chan models.WatchEvent, error) {
+	events := make(chan models.WatchEvent)
+	close(events)
+	return events, nil
+}
+
+func (d *DefaultService) Delete(context.Context, models.DeleteRequest) (models.DeleteResponse, error) {
+	return models.DeleteResponse{}, nil
 }
 
 func (d *DefaultService) Update(context.Context, models.UpdateRequest) error {
 	return nil
 }
+
+func (d *DefaultService) Drift(context.Context, models.DriftRequest) (models.DriftResponse, error) {
+	return models.DriftResponse{}, nil
+}
@@ -0,0 +1,53 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// hostPathStorageClass is stamped on the hostPath volumes created in dev mode, it has no provisioner
+	hostPathStorageClass = "manual"
+	hostPathRoot         = "/data/postgresql/"
+
+	annotationDefaultStorageClass = "storageclass.kubernetes.io/is-default-class"
+
+	storageClassNotFoundError  = "storage_class %s not found"
+	noDefaultStorageClassError = "storage_class not set and the cluster has no default StorageClass"
+)
+
+// storageClass resolves the StorageClass of the claims of a new instance. When it's not set, the
+// cluster default is used, or the hostPath class in dev mode.
+func (s *Postgres) storageClass(ctx context.Context, name string) (string, error) {
+	if name != "" {
+		if _, err := s.kubeClient.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", fmt.Errorf(storageClassNotFoundError, name)
+			}
+			return "", err
+		}
+		return name, nil
+	}
+	if s.config.HostPathStorage {
+		return hostPathStorageClass, nil
+	}
+	storageClasses, err := s.kubeClient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, storageClass := range storageClasses.Items {
+		if storageClass.Annotations[annotationDefaultStorageClass] == "true" {
+			return storageClass.Name, nil
+		}
+	}
+	return "", fmt.Errorf(noDefaultStorageClassError)
+}
+
+// isHostPath tells whether the volumes of a claim have to be created by the service
+func isHostPath(claim *apiv1.PersistentVolumeClaim) bool {
+	return claim.Spec.StorageClassName != nil && *claim.Spec.StorageClassName == hostPathStorageClass
+}
@@ -0,0 +1,173 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	tenantNamespacePrefix = "postgres-tenant-"
+	tenantResourceQuota   = "postgres-quota"
+	tenantLimitRange      = "postgres-limits"
+	tenantHashLength      = 16
+	// Namespace names are DNS labels of up to 63 characters, the prefix and hash suffix take the rest
+	maxTenantReadableLength = validation.DNS1123LabelMaxLength - len(tenantNamespacePrefix) - tenantHashLength - 1
+)
+
+// tenantQuota caps the objects and storage a single tenant can claim
+var tenantQuota = apiv1.ResourceList{
+	apiv1.ResourcePods:                   resource.MustParse("50"),
+	apiv1.ResourceServices:               resource.MustParse("50"),
+	apiv1.ResourcePersistentVolumeClaims: resource.MustParse("50"),
+	apiv1.ResourceRequestsStorage:        resource.MustParse("500Gi"),
+	apiv1.ResourceRequestsCPU:            resource.MustParse("20"),
+	apiv1.ResourceRequestsMemory:         resource.MustParse("64Gi"),
+}
+
+// namespace resolves the namespace of a request: the requested one, the tenant namespace of
+// the owner in tenant mode, or the service default.
+func (s *Postgres) namespace(namespace, owner string) string {
+	switch {
+	case namespace != "":
+		return namespace
+	case s.config.TenantNamespaces && owner != "":
+		return tenantNamespace(owner)
+	case s.config.DefaultNamespace != "":
+		return s.config.DefaultNamespace
+	default:
+		return apiv1.NamespaceDefault
+	}
+}
+
+// tenantNamespace derives the namespace of an owner. Owners are label values, which allow
+// uppercase and characters namespace names don't. Those owners keep a readable name, made unique by
+// a hash suffix so owners only differing by case don't share a namespace.
+func tenantNamespace(owner string) string {
+	name := tenantNamespacePrefix + owner
+	if len(validation.IsDNS1123Label(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(owner))
+	suffix := hex.EncodeToString(sum[:])[:tenantHashLength]
+	readable := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(owner))
+	readable = strings.Trim(readable[:min(len(readable), maxTenantReadableLength)], "-")
+	if readable == "" {
+		return tenantNamespacePrefix + suffix
+	}
+	return tenantNamespacePrefix + readable + "-" + suffix
+}
+
+// ensureTenantNamespace creates the namespace of an owner on its first instance, along with the
+// ResourceQuota and LimitRange isolating it from other tenants.
+func (s *Postgres) ensureTenantNamespace(ctx context.Context, namespace, owner string) error {
+	// An owner could be named after the hashed namespace of another one
+	existing, err := s.kubeClient.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	switch {
+	case err == nil && existing.Labels[labelOwner] != owner:
+		return fmt.Errorf(namespaceNotOwnedError, namespace, owner)
+	case err != nil && !apierrors.IsNotFound(err):
+		return err
+	}
+	// Pods on hostPath storage only comply with the baseline level
+	level := podSecurityRestricted
+	if s.config.HostPathStorage {
+		level = podSecurityBaseline
+	}
+	if err := apply(ctx, s.kubeClient.CoreV1().Namespaces().Apply, setTenantNamespace(namespace, owner, level)); err != nil {
+		return err
+	}
+	if err := apply(ctx, s.kubeClient.CoreV1().ResourceQuotas(namespace).Apply, setTenantResourceQuota(namespace)); err != nil {
+		return err
+	}
+	return apply(ctx, s.kubeClient.CoreV1().LimitRanges(namespace).Apply, setTenantLimitRange(namespace))
+}
+
+func tenantLabels(owner string) map[string]string {
+	return map[string]string{
+		labelManagedBy: labelManagedByValue,
+		labelOwner:     owner,
+	}
+}
+
+// setTenantNamespace only admits pods complying with the given Pod Security Standard
+func setTenantNamespace(namespace, owner, level string) *apiv1.Namespace {
+	labels := tenantLabels(owner)
+	labels[labelPodSecurityEnforce] = level
+	return &apiv1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   namespace,
+			Labels: labels,
+		},
+	}
+}
+
+func setTenantResourceQuota(namespace string) *apiv1.ResourceQuota {
+	return &apiv1.ResourceQuota{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ResourceQuota",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenantResourceQuota,
+			Namespace: namespace,
+			Labels:    map[string]string{labelManagedBy: labelManagedByValue},
+		},
+		Spec: apiv1.ResourceQuotaSpec{
+			Hard: tenantQuota,
+		},
+	}
+}
+
+// setTenantLimitRange gives containers without resources a default, so they are admitted by the quota
+func setTenantLimitRange(namespace string) *apiv1.LimitRange {
+	return &apiv1.LimitRange{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "LimitRange",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenantLimitRange,
+			Namespace: namespace,
+			Labels:    map[string]string{labelManagedBy: labelManagedByValue},
+		},
+		Spec: apiv1.LimitRangeSpec{
+			Limits: []apiv1.LimitRangeItem{
+				{
+					Type: apiv1.LimitTypeContainer,
+					Default: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse("1"),
+						apiv1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+					DefaultRequest: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse("250m"),
+						apiv1.ResourceMemory: resource.MustParse("256Mi"),
+					},
+				},
+				{
+					Type: apiv1.LimitTypePersistentVolumeClaim,
+					Max: apiv1.ResourceList{
+						apiv1.ResourceStorage: resource.MustParse("100Gi"),
+					},
+				},
+			},
+		},
+	}
+}
@@ -3,92 +3,443 @@ package kubernetes
 import (
 	"context"
 	"fmt"
+	"net"
+	"regexp"
 	"schwarz/models"
 	"strings"
 
 	"github.com/google/uuid"
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
-	invalidDBNameLengthError   = "invalid db_name length of %d chars"
-	invalidUUIDError           = "invalid %s UUID format"
-	invalidNumReplicasError    = "invalid number %d of replicas "
-	invalidUserNameLengthError = "invalid user_name length of %d chars"
-	invalidUserPassLengthError = "invalid user_pass length of %d chars"
-	invalidPortNumError        = "invalid port_num %d value"
-	invalidAccessModeError     = "invalid access mode %s"
-	invalidCapacityError       = "invalid capacity %s format"
-
-	minDBNameLength   = 4
-	maxDBNameLength   = 100
-	minUserNameLength = 2
-	maxUserNameLength = 100
-	minUserPassLength = 8
-	maxUserPassLength = 64
-	minPortNum        = 1024
-	maxPortNum        = 65353
-	minReplicas       = 1
-	maxReplicas       = 10
+	invalidDBNameLengthError    = "invalid db_name length of %d chars"
+	invalidUUIDError            = "invalid %s UUID format"
+	invalidNumReplicasError     = "invalid number %d of replicas "
+	invalidUserNameLengthError  = "invalid user_name length of %d chars"
+	invalidUserPassLengthError  = "invalid user_pass length of %d chars"
+	invalidPortNumError         = "invalid port_num %d value"
+	invalidAccessModeError      = "invalid access mode %s"
+	invalidCapacityError        = "invalid capacity %s format"
+	invalidOwnerError           = "invalid owner %s value"
+	invalidPageSizeError        = "invalid page_size %d value"
+	invalidLabelSelectorError   = "invalid label_selector %s format"
+	invalidUpdateMaskError      = "invalid update_mask path %s"
+	invalidImageTagError        = "invalid image_tag %s format"
+	invalidRequestIDLengthError = "invalid request_id length of %d chars"
+	invalidWorkloadError        = "invalid workload %s"
+	invalidStorageClassError    = "invalid storage_class %s format"
+	invalidNamespaceError       = "invalid namespace %s format"
+	invalidExposureError        = "invalid exposure %s"
+	invalidAnnotationError      = "invalid exposure_annotations key %s format"
+	annotationsExposureError    = "exposure_annotations are only supported with loadbalancer exposure"
+	invalidResourceError        = "invalid resources %s %s format"
+	resourceRequestLimitError   = "resources %s %s exceeds its limit %s"
+	invalidProbeError           = "invalid probes %s %d value"
+	invalidAllowedClientError   = "invalid allowed_clients %s %s format"
+	invalidNodeSelectorError    = "invalid scheduling node_selector %s=%s"
+	invalidTolerationError      = "invalid scheduling toleration %s %s"
+	invalidTopologyError        = "invalid scheduling topology %s"
+	invalidTopologySpreadError  = "invalid scheduling topology_spread %s %s"
+	probeTimeoutPeriodError     = "probes timeout_seconds %d exceeds period_seconds %d"
+	invalidImageError           = "invalid image %s format"
+	imageNotAllowedError        = "image %s is not allowed"
+	credentialsUpdateError      = "update_mask path %s is not supported, the role is only created with the data directory"
+	majorVersionUpdateError     = "image %s changes the major version %s of the data directory"
+	imageUpdateConflictError    = "update_mask paths image and image_tag can't be combined"
+
+	minDBNameLength    = 4
+	maxDBNameLength    = 100
+	minUserNameLength  = 2
+	maxUserNameLength  = 100
+	minUserPassLength  = 8
+	maxUserPassLength  = 64
+	minPortNum         = 1024
+	maxPortNum         = 65353
+	minReplicas        = 1
+	maxReplicas        = 10
+	minPageSize        = 0
+	maxPageSize        = 500
+	maxRequestIDLength = 128
+	maxProbePeriod     = 300
+	maxProbeTimeout    = 60
+	maxProbeFailures   = 30
+	maxStartupTimeout  = 3600
 )
 
+// https://github.com/distribution/reference/blob/main/reference.go
+var imageTagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
 type Validator struct {
-	service Service
+	service       Service
+	allowedImages []string // Images, or versions of the official image, instances may run. Any when empty
+	// Resources taking the place of the quantities left empty, so requests are checked against the limits
+	// the pods get
+	defaultResources models.Resources
 }
 
-func NewValidator(service Service) Service {
+func NewValidator(service Service, allowedImages []string, defaultResources models.Resources) Service {
 	return &Validator{
-		service: service,
+		service:          service,
+		allowedImages:    allowedImages,
+		defaultResources: defaultResources,
 	}
 }
 
 func (v *Validator) Create(ctx context.Context, request models.CreateRequest) (models.CreateResponse, error) {
+	if err := v.validateCreate(request); err != nil {
+		return models.CreateResponse{}, err
+	}
+	return v.service.Create(ctx, request)
+}
+
+// validateCreate applies the Create rules, also to the PostgresInstance objects the Controller
+// reconciles since they may be written without the service
+func (v *Validator) validateCreate(request models.CreateRequest) error {
 	if len(request.DBName) < minDBNameLength || len(request.DBName) > maxDBNameLength {
-		return models.CreateResponse{}, fmt.Errorf(invalidDBNameLengthError, len(request.DBName))
+		return fmt.Errorf(invalidDBNameLengthError, len(request.DBName))
 	}
 	if len(request.UserName) < minUserNameLength || len(request.UserName) > maxUserNameLength {
-		return models.CreateResponse{}, fmt.Errorf(invalidUserNameLengthError, len(request.UserName))
+		return fmt.Errorf(invalidUserNameLengthError, len(request.UserName))
 	}
 	if len(request.UserPass) < minUserPassLength || len(request.UserPass) > maxUserPassLength {
-		return models.CreateResponse{}, fmt.Errorf(invalidUserPassLengthError, len(request.UserPass))
+		return fmt.Errorf(invalidUserPassLengthError, len(request.UserPass))
 	}
 	if request.PortNum < minPortNum || request.PortNum > maxPortNum {
-		return models.CreateResponse{}, fmt.Errorf(invalidPortNumError, request.PortNum)
+		return fmt.Errorf(invalidPortNumError, request.PortNum)
 	}
 	if request.Replicas < minReplicas || request.Replicas > maxReplicas {
-		return models.CreateResponse{}, fmt.Errorf(invalidNumReplicasError, request.Replicas)
+		return fmt.Errorf(invalidNumReplicasError, request.Replicas)
 	}
 	if _, err := resource.ParseQuantity(request.Capacity); err != nil {
-		return models.CreateResponse{}, fmt.Errorf(invalidCapacityError, request.Capacity)
+		return fmt.Errorf(invalidCapacityError, request.Capacity)
 	}
 	if !isValidAccessMode(request.AccessMode) {
-		return models.CreateResponse{}, fmt.Errorf(invalidAccessModeError, request.AccessMode)
+		return fmt.Errorf(invalidAccessModeError, request.AccessMode)
 	}
-	return v.service.Create(ctx, request)
+	if !isValidOwner(request.Owner) {
+		return fmt.Errorf(invalidOwnerError, request.Owner)
+	}
+	if len(request.RequestID) > maxRequestIDLength {
+		return fmt.Errorf(invalidRequestIDLengthError, len(request.RequestID))
+	}
+	if !isValidWorkload(request.Workload) {
+		return fmt.Errorf(invalidWorkloadError, request.Workload)
+	}
+	if request.StorageClass != "" && len(validation.IsDNS1123Subdomain(request.StorageClass)) > 0 {
+		return fmt.Errorf(invalidStorageClassError, request.StorageClass)
+	}
+	if !isValidNamespace(request.Namespace) {
+		return fmt.Errorf(invalidNamespaceError, request.Namespace)
+	}
+	if !isValidExposure(request.Exposure) {
+		return fmt.Errorf(invalidExposureError, request.Exposure)
+	}
+	if len(request.ExposureAnnotations) > 0 && !strings.EqualFold(request.Exposure, exposureLoadBalancer) {
+		return fmt.Errorf(annotationsExposureError)
+	}
+	for key := range request.ExposureAnnotations {
+		if len(validation.IsQualifiedName(key)) > 0 {
+			return fmt.Errorf(invalidAnnotationError, key)
+		}
+	}
+	if err := validateResources(withDefaultResources(request.Resources, v.defaultResources)); err != nil {
+		return err
+	}
+	if err := validateProbes(request.Probes); err != nil {
+		return err
+	}
+	if err := validateAllowedClients(request.AllowedClients); err != nil {
+		return err
+	}
+	if err := validateScheduling(request.Scheduling); err != nil {
+		return err
+	}
+	if request.Image != "" && !isValidImage(request.Image) {
+		return fmt.Errorf(invalidImageError, request.Image)
+	}
+	// Requests without image take the service default, checked against the allowlist on start
+	if request.Image != "" && !ImageAllowed(request.Image, v.allowedImages) {
+		return fmt.Errorf(imageNotAllowedError, request.Image)
+	}
+	return nil
 }
 
-func (v *Validator) Delete(ctx context.Context, request models.DeleteRequest) error {
+func (v *Validator) Get(ctx context.Context, request models.GetRequest) (models.GetResponse, error) {
 	if !isValidUUID(request.ID) {
-		return fmt.Errorf(invalidUUIDError, request.ID)
+		return models.GetResponse{}, fmt.Errorf(invalidUUIDError, request.ID)
+	}
+	if !isValidNamespace(request.Namespace) {
+		return models.GetResponse{}, fmt.Errorf(invalidNamespaceError, request.Namespace)
+	}
+	return v.service.Get(ctx, request)
+}
+
+func (v *Validator) List(ctx context.Context, request models.ListRequest) (models.ListResponse, error) {
+	if request.PageSize < minPageSize || request.PageSize > maxPageSize {
+		return models.ListResponse{}, fmt.Errorf(invalidPageSizeError, request.PageSize)
+	}
+	if _, err := labels.Parse(request.LabelSelector); err != nil {
+		return models.ListResponse{}, fmt.Errorf(invalidLabelSelectorError, request.LabelSelector)
+	}
+	if !isValidOwner(request.Owner) {
+		return models.ListResponse{}, fmt.Errorf(invalidOwnerError, request.Owner)
+	}
+	if !isValidNamespace(request.Namespace) {
+		return models.ListResponse{}, fmt.Errorf(invalidNamespaceError, request.Namespace)
+	}
+	return v.service.List(ctx, request)
+}
+
+func (v *Validator) Watch(ctx context.Context, request models.WatchRequest) (<-chan models.WatchEvent, error) {
+	if !isValidUUID(request.ID) {
+		return nil, fmt.Errorf(invalidUUIDError, request.ID)
+	}
+	if !isValidNamespace(request.Namespace) {
+		return nil, fmt.Errorf(invalidNamespaceError, request.Namespace)
+	}
+	return v.service.Watch(ctx, request)
+}
+
+func (v *Validator) Delete(ctx context.Context, request models.DeleteRequest) (models.DeleteResponse, error) {
+	if !isValidUUID(request.ID) {
+		return models.DeleteResponse{}, fmt.Errorf(invalidUUIDError, request.ID)
+	}
+	if !isValidNamespace(request.Namespace) {
+		return models.DeleteResponse{}, fmt.Errorf(invalidNamespaceError, request.Namespace)
 	}
 	return v.service.Delete(ctx, request)
 }
 
+func (v *Validator) Drift(ctx context.Context, request models.DriftRequest) (models.DriftResponse, error) {
+	if !isValidUUID(request.ID) {
+		return models.DriftResponse{}, fmt.Errorf(invalidUUIDError, request.ID)
+	}
+	if !isValidNamespace(request.Namespace) {
+		return models.DriftResponse{}, fmt.Errorf(invalidNamespaceError, request.Namespace)
+	}
+	return v.service.Drift(ctx, request)
+}
+
 func (v *Validator) Update(ctx context.Context, request models.UpdateRequest) error {
 	if !isValidUUID(request.ID) {
 		return fmt.Errorf(invalidUUIDError, request.ID)
 	}
-	if request.Replicas < minReplicas || request.Replicas > maxReplicas {
-		return fmt.Errorf(invalidNumReplicasError, request.Replicas)
+	if !isValidNamespace(request.Namespace) {
+		return fmt.Errorf(invalidNamespaceError, request.Namespace)
+	}
+	mask := sets.New(updatePaths(request)...)
+	for _, path := range sets.List(mask) {
+		if err := validateUpdatePath(path, request); err != nil {
+			return err
+		}
+	}
+	if mask.HasAll(updatePathImage, updatePathImageTag) {
+		return fmt.Errorf(imageUpdateConflictError)
+	}
+	// Images and resources are checked against the ones running
+	if mask.HasAny(updatePathImage, updatePathImageTag) || mask.HasAny(resourcePaths...) {
+		current, err := v.service.Get(ctx, models.GetRequest{ID: request.ID, Namespace: request.Namespace})
+		if err != nil {
+			return err
+		}
+		if mask.HasAny(updatePathImage, updatePathImageTag) {
+			if err := v.validateImageUpdate(current, request, mask); err != nil {
+				return err
+			}
+		}
+		// Masked quantities left empty take the defaults, the others keep their live values
+		resources := maskedResources(current.Resources, withDefaultResources(request.Resources, v.defaultResources), mask.HasAny)
+		if err := validateResources(resources); err != nil {
+			return err
+		}
 	}
 	return v.service.Update(ctx, request)
 }
 
+// validateImageUpdate checks the image replacing the running one against the allowlist. Images of
+// another major version are rejected, the data directory needs pg_upgrade to be read by them.
+func (v *Validator) validateImageUpdate(current models.GetResponse, request models.UpdateRequest, mask sets.Set[string]) error {
+	image := updatedImage(current.Image, request, mask)
+	if !ImageAllowed(image, v.allowedImages) {
+		return fmt.Errorf(imageNotAllowedError, image)
+	}
+	currentVersion, version := majorVersion(current.Image), majorVersion(image)
+	if currentVersion != "" && version != "" && currentVersion != version {
+		return fmt.Errorf(majorVersionUpdateError, image, currentVersion)
+	}
+	return nil
+}
+
+// validateUpdatePath applies Create rules only to the fields being changed
+func validateUpdatePath(path string, request models.UpdateRequest) error {
+	switch path {
+	case updatePathReplicas:
+		if request.Replicas < minReplicas || request.Replicas > maxReplicas {
+			return fmt.Errorf(invalidNumReplicasError, request.Replicas)
+		}
+	case updatePathPortNum:
+		if request.PortNum < minPortNum || request.PortNum > maxPortNum {
+			return fmt.Errorf(invalidPortNumError, request.PortNum)
+		}
+	case updatePathUserName, updatePathUserPass:
+		// postgres only creates the role from the credentials when initializing the data directory
+		return fmt.Errorf(credentialsUpdateError, path)
+	case updatePathCapacity:
+		if _, err := resource.ParseQuantity(request.Capacity); err != nil {
+			return fmt.Errorf(invalidCapacityError, request.Capacity)
+		}
+	case updatePathImageTag:
+		if !imageTagRegexp.MatchString(request.ImageTag) {
+			return fmt.Errorf(invalidImageTagError, request.ImageTag)
+		}
+	case updatePathImage:
+		if !isValidImage(request.Image) {
+			return fmt.Errorf(invalidImageError, request.Image)
+		}
+	case updatePathResources, updatePathCPURequest, updatePathCPULimit, updatePathMemoryRequest, updatePathMemoryLimit:
+		return validateResources(request.Resources)
+	default:
+		return fmt.Errorf(invalidUpdateMaskError, path)
+	}
+	return nil
+}
+
+// validateResources parses the quantities set, a request can't exceed the limit of the same resource
+func validateResources(resources models.Resources) error {
+	pairs := []struct {
+		name           string
+		request, limit string
+	}{
+		{"cpu", resources.CPURequest, resources.CPULimit},
+		{"memory", resources.MemoryRequest, resources.MemoryLimit},
+	}
+	for _, pair := range pairs {
+		var request, limit resource.Quantity
+		var err error
+		if pair.request != "" {
+			if request, err = resource.ParseQuantity(pair.request); err != nil || request.Sign() < 0 {
+				return fmt.Errorf(invalidResourceError, pair.name+"_request", pair.request)
+			}
+		}
+		if pair.limit != "" {
+			if limit, err = resource.ParseQuantity(pair.limit); err != nil || limit.Sign() < 0 {
+				return fmt.Errorf(invalidResourceError, pair.name+"_limit", pair.limit)
+			}
+		}
+		if pair.request != "" && pair.limit != "" && request.Cmp(limit) > 0 {
+			return fmt.Errorf(resourceRequestLimitError, pair.name+"_request", pair.request, pair.limit)
+		}
+	}
+	return nil
+}
+
+// validateProbes checks the probe settings, zero values take the defaults
+func validateProbes(probes models.Probes) error {
+	settings := []struct {
+		name       string
+		value, max int32
+	}{
+		{"period_seconds", probes.PeriodSeconds, maxProbePeriod},
+		{"timeout_seconds", probes.TimeoutSeconds, maxProbeTimeout},
+		{"failure_threshold", probes.FailureThreshold, maxProbeFailures},
+		{"startup_timeout_seconds", probes.StartupTimeoutSeconds, maxStartupTimeout},
+	}
+	for _, setting := range settings {
+		if setting.value < 0 || setting.value > setting.max {
+			return fmt.Errorf(invalidProbeError, setting.name, setting.value)
+		}
+	}
+	probes = withDefaultProbes(probes)
+	if probes.TimeoutSeconds > probes.PeriodSeconds {
+		return fmt.Errorf(probeTimeoutPeriodError, probes.TimeoutSeconds, probes.PeriodSeconds)
+	}
+	return nil
+}
+
+func validateAllowedClients(allowedClients models.AllowedClients) error {
+	for _, selector := range allowedClients.NamespaceSelectors {
+		if _, err := metav1.ParseToLabelSelector(selector); err != nil {
+			return fmt.Errorf(invalidAllowedClientError, "namespace_selectors", selector)
+		}
+	}
+	for _, selector := range allowedClients.PodSelectors {
+		if _, err := metav1.ParseToLabelSelector(selector); err != nil {
+			return fmt.Errorf(invalidAllowedClientError, "pod_selectors", selector)
+		}
+	}
+	for _, cidr := range allowedClients.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf(invalidAllowedClientError, "cidrs", cidr)
+		}
+	}
+	return nil
+}
+
+func validateScheduling(scheduling models.Scheduling) error {
+	for key, value := range scheduling.NodeSelector {
+		if len(validation.IsQualifiedName(key)) > 0 || len(validation.IsValidLabelValue(value)) > 0 {
+			return fmt.Errorf(invalidNodeSelectorError, key, value)
+		}
+	}
+	for _, toleration := range scheduling.Tolerations {
+		switch {
+		case toleration.Key != "" && len(validation.IsQualifiedName(toleration.Key)) > 0:
+			return fmt.Errorf(invalidTolerationError, "key", toleration.Key)
+		case !isOneOf(toleration.Operator, "", string(apiv1.TolerationOpEqual), string(apiv1.TolerationOpExists)):
+			return fmt.Errorf(invalidTolerationError, "operator", toleration.Operator)
+		case toleration.Operator == string(apiv1.TolerationOpExists) && toleration.Value != "":
+			return fmt.Errorf(invalidTolerationError, "value", toleration.Value)
+		case toleration.Operator != string(apiv1.TolerationOpExists) && toleration.Key == "":
+			return fmt.Errorf(invalidTolerationError, "key", toleration.Key)
+		case !isOneOf(toleration.Effect, "", string(apiv1.TaintEffectNoSchedule), string(apiv1.TaintEffectPreferNoSchedule), string(apiv1.TaintEffectNoExecute)):
+			return fmt.Errorf(invalidTolerationError, "effect", toleration.Effect)
+		}
+	}
+	if topology := scheduling.AntiAffinity.Topology; topology != "" && !isValidTopology(topology) {
+		return fmt.Errorf(invalidTopologyError, topology)
+	}
+	for _, spread := range scheduling.TopologySpread {
+		switch {
+		case !isValidTopology(spread.Topology):
+			return fmt.Errorf(invalidTopologyError, spread.Topology)
+		case spread.MaxSkew < 1:
+			return fmt.Errorf(invalidTopologySpreadError, "max_skew", fmt.Sprint(spread.MaxSkew))
+		case spread.WhenUnsatisfiable != "" && !isOneOf(strings.ToLower(spread.WhenUnsatisfiable), strings.ToLower(string(apiv1.ScheduleAnyway)), strings.ToLower(string(apiv1.DoNotSchedule))):
+			return fmt.Errorf(invalidTopologySpreadError, "when_unsatisfiable", spread.WhenUnsatisfiable)
+		}
+	}
+	return nil
+}
+
+func isValidTopology(t string) bool {
+	_, ok := topologyKeys[strings.ToLower(t)]
+	return ok
+}
+
+func isOneOf(value string, valid ...string) bool {
+	for _, v := range valid {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
 func isValidUUID(u string) bool {
 	_, err := uuid.Parse(u)
 	return err == nil
 }
 
+func isValidOwner(o string) bool {
+	return o == "" || len(validation.IsValidLabelValue(o)) == 0
+}
+
 func isValidAccessMode(a string) bool {
 	validAccessModes := []string{"readwriteonce", "readonlymany", "readwritemany", "readwriteoncepod"}
 	for _, validAccessMode := range validAccessModes {
@@ -98,3 +449,21 @@ func isValidAccessMode(a string) bool {
 	}
 	return false
 }
+
+func isValidNamespace(n string) bool {
+	return n == "" || len(validation.IsDNS1123Label(n)) == 0
+}
+
+func isValidExposure(e string) bool {
+	validExposures := []string{exposureClusterIP, exposureNodePort, exposureLoadBalancer, exposureHeadless}
+	for _, validExposure := range validExposures {
+		if strings.EqualFold(validExposure, e) {
+			return true
+		}
+	}
+	return e == ""
+}
+
+func isValidWorkload(w string) bool {
+	return w == "" || strings.EqualFold(w, workloadStatefulSet) || strings.EqualFold(w, workloadDeployment)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"schwarz/models"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
@@ -12,7 +13,7 @@ import (
 
 // GIVEN CreateValidator
 func TestCreateValidator(t *testing.T) {
-	validator := NewValidator(NewDefault())
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
 	tcs := []struct {
 		description string
 		incoming    models.CreateRequest
@@ -133,6 +134,236 @@ func TestCreateValidator(t *testing.T) {
 			},
 			expectedErr: fmt.Errorf(invalidAccessModeError, "random"),
 		},
+		{
+			description: "WHEN Owner has no valid label value THEN invalidOwnerError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Owner:      "team a",
+			},
+			expectedErr: fmt.Errorf(invalidOwnerError, "team a"),
+		},
+		{
+			description: "WHEN RequestID is higher than maxRequestIDLength (128) THEN invalidRequestIDLengthError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				RequestID:  generateString(maxRequestIDLength + 1),
+			},
+			expectedErr: fmt.Errorf(invalidRequestIDLengthError, maxRequestIDLength+1),
+		},
+		{
+			description: "WHEN Workload is not statefulset or deployment THEN invalidWorkloadError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Workload:   "daemonset",
+			},
+			expectedErr: fmt.Errorf(invalidWorkloadError, "daemonset"),
+		},
+		{
+			description: "WHEN StorageClass is not a valid object name THEN invalidStorageClassError",
+			incoming: models.CreateRequest{
+				DBName:       generateString(maxDBNameLength),
+				UserName:     generateString(maxUserNameLength),
+				UserPass:     generateString(maxUserPassLength),
+				PortNum:      maxPortNum,
+				Replicas:     maxReplicas,
+				Capacity:     "10Mi",
+				AccessMode:   "ReadOnlyMany",
+				StorageClass: "Fast SSD",
+			},
+			expectedErr: fmt.Errorf(invalidStorageClassError, "Fast SSD"),
+		},
+		{
+			description: "WHEN Exposure is not a supported Service type THEN invalidExposureError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Exposure:   "ingress",
+			},
+			expectedErr: fmt.Errorf(invalidExposureError, "ingress"),
+		},
+		{
+			description: "WHEN ExposureAnnotations are set without loadbalancer exposure THEN annotationsExposureError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Exposure:   "NodePort",
+				ExposureAnnotations: map[string]string{
+					"service.beta.kubernetes.io/aws-load-balancer-internal": "true",
+				},
+			},
+			expectedErr: fmt.Errorf(annotationsExposureError),
+		},
+		{
+			description: "WHEN ExposureAnnotations key is not a qualified name THEN invalidAnnotationError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Exposure:   "LoadBalancer",
+				ExposureAnnotations: map[string]string{
+					"internal load balancer": "true",
+				},
+			},
+			expectedErr: fmt.Errorf(invalidAnnotationError, "internal load balancer"),
+		},
+		{
+			description: "WHEN Resources has no valid Quantity format THEN invalidResourceError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Resources:  models.Resources{MemoryRequest: "1 GB"},
+			},
+			expectedErr: fmt.Errorf(invalidResourceError, "memory_request", "1 GB"),
+		},
+		{
+			description: "WHEN Resources request is higher than its limit THEN resourceRequestLimitError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Resources:  models.Resources{CPURequest: "2", CPULimit: "500m"},
+			},
+			expectedErr: fmt.Errorf(resourceRequestLimitError, "cpu_request", "2", "500m"),
+		},
+		{
+			description: "WHEN Probes setting is higher than its maximum THEN invalidProbeError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Probes:     models.Probes{StartupTimeoutSeconds: maxStartupTimeout + 1},
+			},
+			expectedErr: fmt.Errorf(invalidProbeError, "startup_timeout_seconds", maxStartupTimeout+1),
+		},
+		{
+			description: "WHEN Probes timeout is higher than the default period THEN probeTimeoutPeriodError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Probes:     models.Probes{TimeoutSeconds: 30},
+			},
+			expectedErr: fmt.Errorf(probeTimeoutPeriodError, 30, defaultProbePeriodSeconds),
+		},
+		{
+			description: "WHEN AllowedClients CIDR has no valid format THEN invalidAllowedClientError",
+			incoming: models.CreateRequest{
+				DBName:         generateString(maxDBNameLength),
+				UserName:       generateString(maxUserNameLength),
+				UserPass:       generateString(maxUserPassLength),
+				PortNum:        maxPortNum,
+				Replicas:       maxReplicas,
+				Capacity:       "10Mi",
+				AccessMode:     "ReadOnlyMany",
+				AllowedClients: models.AllowedClients{CIDRs: []string{"10.0.0.0/8", "10.0.0.1"}},
+			},
+			expectedErr: fmt.Errorf(invalidAllowedClientError, "cidrs", "10.0.0.1"),
+		},
+		{
+			description: "WHEN AllowedClients pod selector has no valid format THEN invalidAllowedClientError",
+			incoming: models.CreateRequest{
+				DBName:         generateString(maxDBNameLength),
+				UserName:       generateString(maxUserNameLength),
+				UserPass:       generateString(maxUserPassLength),
+				PortNum:        maxPortNum,
+				Replicas:       maxReplicas,
+				Capacity:       "10Mi",
+				AccessMode:     "ReadOnlyMany",
+				AllowedClients: models.AllowedClients{PodSelectors: []string{"app in (api"}},
+			},
+			expectedErr: fmt.Errorf(invalidAllowedClientError, "pod_selectors", "app in (api"),
+		},
+		{
+			description: "WHEN Scheduling toleration with Exists operator has a value THEN invalidTolerationError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Scheduling: models.Scheduling{Tolerations: []models.Toleration{{Key: "dedicated", Operator: "Exists", Value: "db"}}},
+			},
+			expectedErr: fmt.Errorf(invalidTolerationError, "value", "db"),
+		},
+		{
+			description: "WHEN Scheduling anti-affinity topology is not node or zone THEN invalidTopologyError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Scheduling: models.Scheduling{AntiAffinity: models.AntiAffinity{Topology: "region"}},
+			},
+			expectedErr: fmt.Errorf(invalidTopologyError, "region"),
+		},
+		{
+			description: "WHEN Scheduling topology spread max skew is less than 1 THEN invalidTopologySpreadError",
+			incoming: models.CreateRequest{
+				DBName:     generateString(maxDBNameLength),
+				UserName:   generateString(maxUserNameLength),
+				UserPass:   generateString(maxUserPassLength),
+				PortNum:    maxPortNum,
+				Replicas:   maxReplicas,
+				Capacity:   "10Mi",
+				AccessMode: "ReadOnlyMany",
+				Scheduling: models.Scheduling{TopologySpread: []models.TopologySpread{{Topology: "zone"}}},
+			},
+			expectedErr: fmt.Errorf(invalidTopologySpreadError, "max_skew", "0"),
+		},
 		{
 			description: "WHEN all values are valid THEN error is nil",
 			incoming: models.CreateRequest{
@@ -159,9 +390,105 @@ func TestCreateValidator(t *testing.T) {
 	}
 }
 
+// GIVEN ListValidator
+func TestListValidator(t *testing.T) {
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
+	tcs := []struct {
+		description string
+		incoming    models.ListRequest
+		expectedErr error
+	}{
+		{
+			description: "WHEN PageSize is less than minPageSize (0) THEN invalidPageSizeError",
+			incoming: models.ListRequest{
+				PageSize: minPageSize - 1,
+			},
+			expectedErr: fmt.Errorf(invalidPageSizeError, minPageSize-1),
+		},
+		{
+			description: "WHEN PageSize is higher than maxPageSize (500) THEN invalidPageSizeError",
+			incoming: models.ListRequest{
+				PageSize: maxPageSize + 1,
+			},
+			expectedErr: fmt.Errorf(invalidPageSizeError, maxPageSize+1),
+		},
+		{
+			description: "WHEN LabelSelector has no valid format THEN invalidLabelSelectorError",
+			incoming: models.ListRequest{
+				PageSize:      maxPageSize,
+				LabelSelector: "tier in (",
+			},
+			expectedErr: fmt.Errorf(invalidLabelSelectorError, "tier in ("),
+		},
+		{
+			description: "WHEN Owner has no valid label value THEN invalidOwnerError",
+			incoming: models.ListRequest{
+				PageSize:      maxPageSize,
+				LabelSelector: "tier=backend",
+				Owner:         "team a",
+			},
+			expectedErr: fmt.Errorf(invalidOwnerError, "team a"),
+		},
+		{
+			description: "WHEN all values are valid THEN error is nil",
+			incoming: models.ListRequest{
+				PageSize:      maxPageSize,
+				LabelSelector: "tier=backend",
+				Owner:         "team-a",
+			},
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := validator.List(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// GIVEN WatchValidator
+func TestWatchValidator(t *testing.T) {
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
+	tcs := []struct {
+		description string
+		incoming    models.WatchRequest
+		expectedErr error
+	}{
+		{
+			description: "WHEN ID has no valid UUID format THEN invalidUUIDError",
+			incoming: models.WatchRequest{
+				ID: "random",
+			},
+			expectedErr: fmt.Errorf(invalidUUIDError, "random"),
+		},
+		{
+			description: "WHEN all values are valid THEN error is nil",
+			incoming: models.WatchRequest{
+				ID: uuid.New().String(),
+			},
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := validator.Watch(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
 // GIVEN UpdateValidator
 func TestUpdateValidator(t *testing.T) {
-	validator := NewValidator(NewDefault())
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
 	tcs := []struct {
 		description string
 		incoming    models.UpdateRequest
@@ -190,6 +517,78 @@ func TestUpdateValidator(t *testing.T) {
 			},
 			expectedErr: fmt.Errorf(invalidNumReplicasError, maxReplicas+1),
 		},
+		{
+			description: "WHEN UpdateMask has an unknown path THEN invalidUpdateMaskError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"access_mode"},
+			},
+			expectedErr: fmt.Errorf(invalidUpdateMaskError, "access_mode"),
+		},
+		{
+			description: "WHEN UpdateMask has port_num and PortNum is higher than maxPortNum (65353) THEN invalidPortNumError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"port_num"},
+				PortNum:    maxPortNum + 1,
+			},
+			expectedErr: fmt.Errorf(invalidPortNumError, maxPortNum+1),
+		},
+		{
+			description: "WHEN UpdateMask has user_pass THEN credentialsUpdateError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"user_pass"},
+				UserPass:   generateString(minUserPassLength),
+			},
+			expectedErr: fmt.Errorf(credentialsUpdateError, "user_pass"),
+		},
+		{
+			description: "WHEN UpdateMask has user_name THEN credentialsUpdateError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"user_name"},
+				UserName:   generateString(minUserNameLength),
+			},
+			expectedErr: fmt.Errorf(credentialsUpdateError, "user_name"),
+		},
+		{
+			description: "WHEN UpdateMask has capacity and Capacity has no valid Quantity format THEN invalidCapacityError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"capacity"},
+				Capacity:   "M10",
+			},
+			expectedErr: fmt.Errorf(invalidCapacityError, "M10"),
+		},
+		{
+			description: "WHEN UpdateMask has image_tag and ImageTag has no valid format THEN invalidImageTagError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"image_tag"},
+				ImageTag:   "16:latest",
+			},
+			expectedErr: fmt.Errorf(invalidImageTagError, "16:latest"),
+		},
+		{
+			description: "WHEN UpdateMask has resources.cpu_limit and CPULimit is negative THEN invalidResourceError",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"resources.cpu_limit"},
+				Resources:  models.Resources{CPULimit: "-1"},
+			},
+			expectedErr: fmt.Errorf(invalidResourceError, "cpu_limit", "-1"),
+		},
+		{
+			description: "WHEN UpdateMask has not replicas THEN Replicas is not validated and error is nil",
+			incoming: models.UpdateRequest{
+				ID:         uuid.New().String(),
+				UpdateMask: []string{"port_num", "image_tag"},
+				PortNum:    minPortNum,
+				ImageTag:   "16.2-alpine",
+			},
+			expectedErr: nil,
+		},
 		{
 			description: "WHEN all values are valid THEN error is nil",
 			incoming: models.UpdateRequest{
@@ -211,9 +610,52 @@ func TestUpdateValidator(t *testing.T) {
 	}
 }
 
+// GIVEN GetValidator
+func TestGetValidator(t *testing.T) {
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
+	tcs := []struct {
+		description string
+		incoming    models.GetRequest
+		expectedErr error
+	}{
+		{
+			description: "WHEN ID has no valid UUID format THEN invalidUUIDError",
+			incoming: models.GetRequest{
+				ID: "random",
+			},
+			expectedErr: fmt.Errorf(invalidUUIDError, "random"),
+		},
+		{
+			description: "WHEN Namespace is not a valid namespace name THEN invalidNamespaceError",
+			incoming: models.GetRequest{
+				ID:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				Namespace: "Team_A",
+			},
+			expectedErr: fmt.Errorf(invalidNamespaceError, "Team_A"),
+		},
+		{
+			description: "WHEN all values are valid THEN error is nil",
+			incoming: models.GetRequest{
+				ID: uuid.New().String(),
+			},
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := validator.Get(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
 // GIVEN UpdateValidator
 func TestDeleteValidator(t *testing.T) {
-	validator := NewValidator(NewDefault())
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
 	tcs := []struct {
 		description string
 		incoming    models.DeleteRequest
@@ -226,6 +668,14 @@ func TestDeleteValidator(t *testing.T) {
 			},
 			expectedErr: fmt.Errorf(invalidUUIDError, "random"),
 		},
+		{
+			description: "WHEN Namespace is not a valid namespace name THEN invalidNamespaceError",
+			incoming: models.DeleteRequest{
+				ID:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				Namespace: "Team_A",
+			},
+			expectedErr: fmt.Errorf(invalidNamespaceError, "Team_A"),
+		},
 		{
 			description: "WHEN all values are valid THEN error is nil",
 			incoming: models.DeleteRequest{
@@ -236,7 +686,288 @@ func TestDeleteValidator(t *testing.T) {
 	}
 	for _, tc := range tcs {
 		t.Run(tc.description, func(t *testing.T) {
-			err := validator.Delete(context.Background(), tc.incoming)
+			_, err := validator.Delete(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// GIVEN DriftValidator
+func TestDriftValidator(t *testing.T) {
+	validator := NewValidator(NewDefault(), nil, models.Resources{})
+	tcs := []struct {
+		description string
+		incoming    models.DriftRequest
+		expectedErr error
+	}{
+		{
+			description: "WHEN ID has no valid UUID format THEN invalidUUIDError",
+			incoming: models.DriftRequest{
+				ID: "random",
+			},
+			expectedErr: fmt.Errorf(invalidUUIDError, "random"),
+		},
+		{
+			description: "WHEN Namespace is not a valid namespace name THEN invalidNamespaceError",
+			incoming: models.DriftRequest{
+				ID:        "ac5eaeee-0c5a-4478-9af0-e7e1d94d9e2b",
+				Namespace: "Team_A",
+			},
+			expectedErr: fmt.Errorf(invalidNamespaceError, "Team_A"),
+		},
+		{
+			description: "WHEN all values are valid THEN error is nil",
+			incoming: models.DriftRequest{
+				ID: uuid.New().String(),
+			},
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := validator.Drift(context.Background(), tc.incoming)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// GIVEN a Validator with an image allowlist
+func TestImageValidator(t *testing.T) {
+	digest := "registry.example.com/postgres@sha256:" + strings.Repeat("a", 64)
+	validator := NewValidator(NewDefault(), []string{"15", "postgres:16", digest}, models.Resources{})
+	create := func(image string) models.CreateRequest {
+		return models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "password", PortNum: minPortNum, Replicas: minReplicas, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Image: image}
+	}
+	tcs := []struct {
+		description string
+		incoming    func() error
+		expectedErr error
+	}{
+		{
+			description: "WHEN Image has no valid format THEN invalidImageError",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create("Postgres:16"))
+				return err
+			},
+			expectedErr: fmt.Errorf(invalidImageError, "Postgres:16"),
+		},
+		{
+			description: "WHEN Image is not in the allowlist THEN imageNotAllowedError",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create("postgres:17"))
+				return err
+			},
+			expectedErr: fmt.Errorf(imageNotAllowedError, "postgres:17"),
+		},
+		{
+			description: "WHEN Image is an allowed version THEN error is nil",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create("postgres:15"))
+				return err
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN Image is an allowed digest THEN error is nil",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create(digest))
+				return err
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN Image is empty THEN the service default is used and error is nil",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create(""))
+				return err
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN UpdateMask has image_tag not in the allowlist THEN imageNotAllowedError",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: uuid.New().String(), UpdateMask: []string{updatePathImageTag}, ImageTag: "17"})
+			},
+			expectedErr: fmt.Errorf(imageNotAllowedError, "postgres:17"),
+		},
+		{
+			description: "WHEN UpdateMask has an allowed image_tag THEN error is nil",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: uuid.New().String(), UpdateMask: []string{updatePathImageTag}, ImageTag: "16"})
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN UpdateMask has an image not in the allowlist THEN imageNotAllowedError",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: uuid.New().String(), UpdateMask: []string{updatePathImage}, Image: "registry.example.com/postgres:16"})
+			},
+			expectedErr: fmt.Errorf(imageNotAllowedError, "registry.example.com/postgres:16"),
+		},
+		{
+			description: "WHEN UpdateMask has an allowed image digest THEN error is nil",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: uuid.New().String(), UpdateMask: []string{updatePathImage}, Image: digest})
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN UpdateMask has an image with no valid format THEN invalidImageError",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: uuid.New().String(), UpdateMask: []string{updatePathImage}, Image: "Postgres:16"})
+			},
+			expectedErr: fmt.Errorf(invalidImageError, "Postgres:16"),
+		},
+		{
+			description: "WHEN UpdateMask has both image and image_tag THEN imageUpdateConflictError",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: uuid.New().String(), UpdateMask: []string{updatePathImage, updatePathImageTag}, Image: "15", ImageTag: "16"})
+			},
+			expectedErr: fmt.Errorf(imageUpdateConflictError),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.incoming()
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// GIVEN an instance running postgres 14
+func TestMajorVersionValidator(t *testing.T) {
+	postgres := NewPostgres(newFakeClientset(), newTestMetrics(t), PostgresConfig{HostPathStorage: true})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "password", PortNum: minPortNum, Replicas: minReplicas, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Image: "14"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	validator := NewValidator(postgres, nil, models.Resources{})
+	tcs := []struct {
+		description string
+		imageTag    string
+		image       string
+		expectedErr error
+	}{
+		{
+			description: "WHEN image_tag is another major version THEN majorVersionUpdateError",
+			imageTag:    "16",
+			expectedErr: fmt.Errorf(majorVersionUpdateError, "postgres:16", "14"),
+		},
+		{
+			description: "WHEN image_tag is a minor version of the same major version THEN error is nil",
+			imageTag:    "14.12-alpine",
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN image is another major version THEN majorVersionUpdateError",
+			image:       "registry.example.com/postgres:15.3",
+			expectedErr: fmt.Errorf(majorVersionUpdateError, "registry.example.com/postgres:15.3", "14"),
+		},
+		{
+			description: "WHEN image is the same major version from another registry THEN error is nil",
+			image:       "registry.example.com/postgres:14.12",
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN image_tag has no version THEN error is nil",
+			imageTag:    "latest",
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			request := models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathImageTag}, ImageTag: tc.imageTag}
+			if tc.image != "" {
+				request = models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathImage}, Image: tc.image}
+			}
+			err := validator.Update(context.Background(), request)
+			if (err != nil) != (tc.expectedErr != nil) {
+				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
+			} else if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Errorf("expected error = %v, received error = %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// GIVEN service default resources and an instance running with a higher cpu limit
+func TestResourcesValidator(t *testing.T) {
+	defaults := models.Resources{CPURequest: "250m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"}
+	postgres := NewPostgres(newFakeClientset(), newTestMetrics(t), PostgresConfig{HostPathStorage: true, DefaultResources: defaults})
+	response, err := postgres.Create(context.Background(), models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "password", PortNum: minPortNum, Replicas: minReplicas, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Resources: models.Resources{CPULimit: "4"}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	validator := NewValidator(postgres, nil, defaults)
+	create := func(resources models.Resources) models.CreateRequest {
+		return models.CreateRequest{DBName: "dbName", UserName: "user", UserPass: "password", PortNum: minPortNum, Replicas: minReplicas, Capacity: "10Mi", AccessMode: "ReadWriteOnce", Resources: resources}
+	}
+	tcs := []struct {
+		description string
+		incoming    func() error
+		expectedErr error
+	}{
+		{
+			description: "WHEN cpu_request alone exceeds the default cpu_limit THEN resourceRequestLimitError",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create(models.Resources{CPURequest: "2"}))
+				return err
+			},
+			expectedErr: fmt.Errorf(resourceRequestLimitError, "cpu_request", "2", "1"),
+		},
+		{
+			description: "WHEN memory_request alone exceeds the default memory_limit THEN resourceRequestLimitError",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create(models.Resources{MemoryRequest: "2Gi"}))
+				return err
+			},
+			expectedErr: fmt.Errorf(resourceRequestLimitError, "memory_request", "2Gi", "1Gi"),
+		},
+		{
+			description: "WHEN cpu_request alone is within the default cpu_limit THEN error is nil",
+			incoming: func() error {
+				_, err := validator.Create(context.Background(), create(models.Resources{CPURequest: "500m"}))
+				return err
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN UpdateMask has cpu_request within the live cpu_limit THEN error is nil",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathCPURequest}, Resources: models.Resources{CPURequest: "2"}})
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "WHEN UpdateMask has cpu_request exceeding the live cpu_limit THEN resourceRequestLimitError",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathCPURequest}, Resources: models.Resources{CPURequest: "8"}})
+			},
+			expectedErr: fmt.Errorf(resourceRequestLimitError, "cpu_request", "8", "4"),
+		},
+		{
+			description: "WHEN UpdateMask has memory_request alone exceeding the live memory_limit THEN resourceRequestLimitError",
+			incoming: func() error {
+				return validator.Update(context.Background(), models.UpdateRequest{ID: response.ID, UpdateMask: []string{updatePathMemoryRequest}, Resources: models.Resources{MemoryRequest: "2Gi"}})
+			},
+			expectedErr: fmt.Errorf(resourceRequestLimitError, "memory_request", "2Gi", "1Gi"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.incoming()
 			if (err != nil) != (tc.expectedErr != nil) {
 				t.Errorf("expected error is nil = %t, received error is nil = %t - error is = %v", tc.expectedErr == nil, err == nil, err)
 			} else if err != nil && err.Error() != tc.expectedErr.Error() {
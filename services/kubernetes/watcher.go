@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"schwarz/models"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// instanceWatcher translates StatefulSet or Deployment, PersistentVolumeClaim and Pod changes of
+// a single Postgres instance into lifecycle events, sending only state transitions.
+type instanceWatcher struct {
+	id        string
+	events    chan<- models.WatchEvent
+	state     models.EventType
+	bound     map[string]bool
+	scheduled map[string]bool
+}
+
+func newInstanceWatcher(id string, events chan<- models.WatchEvent) *instanceWatcher {
+	return &instanceWatcher{
+		id:        id,
+		events:    events,
+		bound:     make(map[string]bool),
+		scheduled: make(map[string]bool),
+	}
+}
+
+// run consumes the watch channels until the context is done, any of the channels is closed
+// or the workload is deleted.
+func (w *instanceWatcher) run(ctx context.Context, workloads, claims, pods <-chan watch.Event) {
+	for {
+		var next bool
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-workloads:
+			if !ok {
+				return
+			}
+			workload, ok := fromObject(event.Object)
+			next = !ok || w.onWorkload(ctx, event.Type, workload)
+		case event, ok := <-claims:
+			if !ok {
+				return
+			}
+			claim, ok := event.Object.(*apiv1.PersistentVolumeClaim)
+			next = !ok || w.onClaim(ctx, event.Type, claim)
+		case event, ok := <-pods:
+			if !ok {
+				return
+			}
+			pod, ok := event.Object.(*apiv1.Pod)
+			next = !ok || w.onPod(ctx, event.Type, pod)
+		}
+		if !next {
+			return
+		}
+	}
+}
+
+// onWorkload returns false once no more events must be sent.
+func (w *instanceWatcher) onWorkload(ctx context.Context, eventType watch.EventType, workload *workload) bool {
+	if eventType == watch.Deleted {
+		w.send(ctx, models.EventDeleted, workload.name, workload.kind+" deleted")
+		return false
+	}
+	desired := workload.replicas
+	ready := workload.readyReplicas
+	message := fmt.Sprintf("%d/%d replicas ready", ready, desired)
+	switch {
+	case workload.deletionTimestamp != nil:
+		return w.transition(ctx, models.EventDeleting, workload.name, workload.kind+" marked for deletion")
+	case desired > 0 && ready >= desired:
+		return w.transition(ctx, models.EventReady, workload.name, message)
+	case w.state == models.EventReady || w.state == models.EventDegraded:
+		return w.transition(ctx, models.EventDegraded, workload.name, message)
+	default:
+		return w.transition(ctx, models.EventProvisioning, workload.name, message)
+	}
+}
+
+// onClaim returns false once no more events must be sent.
+func (w *instanceWatcher) onClaim(ctx context.Context, eventType watch.EventType, claim *apiv1.PersistentVolumeClaim) bool {
+	if eventType == watch.Deleted {
+		delete(w.bound, claim.Name)
+		return true
+	}
+	if w.bound[claim.Name] || claim.Status.Phase != apiv1.ClaimBound {
+		return true
+	}
+	w.bound[claim.Name] = true
+	return w.send(ctx, models.EventPVCBound, claim.Name, "bound to volume "+claim.Spec.VolumeName)
+}
+
+// onPod returns false once no more events must be sent.
+func (w *instanceWatcher) onPod(ctx context.Context, eventType watch.EventType, pod *apiv1.Pod) bool {
+	if eventType == watch.Deleted {
+		delete(w.scheduled, pod.Name)
+		return true
+	}
+	if w.scheduled[pod.Name] {
+		return true
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionTrue {
+			w.scheduled[pod.Name] = true
+			return w.send(ctx, models.EventPodScheduled, pod.Name, "scheduled on node "+pod.Spec.NodeName)
+		}
+	}
+	return true
+}
+
+func (w *instanceWatcher) transition(ctx context.Context, state models.EventType, object, message string) bool {
+	if w.state == state {
+		return true
+	}
+	w.state = state
+	return w.send(ctx, state, object, message)
+}
+
+func (w *instanceWatcher) send(ctx context.Context, eventType models.EventType, object, message string) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case w.events <- models.WatchEvent{
+		ID:        w.id,
+		Type:      eventType,
+		Object:    object,
+		Message:   message,
+		Timestamp: time.Now(),
+	}:
+		return true
+	}
+}
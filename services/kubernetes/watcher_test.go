@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"context"
+	"schwarz/models"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// GIVEN instanceWatcher
+func TestInstanceWatcher(t *testing.T) {
+	replicas := int32(2)
+	now := metav1.Now()
+	deployment := func(ready int32, deletion *metav1.Time) watch.Event {
+		return watch.Event{Type: watch.Modified, Object: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "id", DeletionTimestamp: deletion},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: ready},
+		}}
+	}
+	claim := func(phase apiv1.PersistentVolumeClaimPhase) watch.Event {
+		return watch.Event{Type: watch.Modified, Object: &apiv1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "claim"},
+			Status:     apiv1.PersistentVolumeClaimStatus{Phase: phase},
+		}}
+	}
+	pod := func(scheduled apiv1.ConditionStatus) watch.Event {
+		return watch.Event{Type: watch.Modified, Object: &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+			Status:     apiv1.PodStatus{Conditions: []apiv1.PodCondition{{Type: apiv1.PodScheduled, Status: scheduled}}},
+		}}
+	}
+	tcs := []struct {
+		description string
+		deployments []watch.Event
+		claims      []watch.Event
+		pods        []watch.Event
+		expected    []models.EventType
+	}{
+		{
+			description: "WHEN deployment becomes ready THEN Provisioning and Ready are sent once",
+			deployments: []watch.Event{deployment(0, nil), deployment(1, nil), deployment(2, nil), deployment(2, nil)},
+			expected:    []models.EventType{models.EventProvisioning, models.EventReady},
+		},
+		{
+			description: "WHEN ready replicas drop THEN Degraded is sent",
+			deployments: []watch.Event{deployment(2, nil), deployment(1, nil), deployment(0, nil), deployment(2, nil)},
+			expected:    []models.EventType{models.EventReady, models.EventDegraded, models.EventReady},
+		},
+		{
+			description: "WHEN deployment is deleted THEN Deleting and Deleted are sent and watch finishes",
+			deployments: []watch.Event{
+				deployment(2, nil),
+				deployment(2, &now),
+				{Type: watch.Deleted, Object: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "id"}}},
+				deployment(2, nil),
+			},
+			expected: []models.EventType{models.EventReady, models.EventDeleting, models.EventDeleted},
+		},
+		{
+			description: "WHEN claim is bound THEN PVCBound is sent once",
+			claims:      []watch.Event{claim(apiv1.ClaimPending), claim(apiv1.ClaimBound), claim(apiv1.ClaimBound)},
+			expected:    []models.EventType{models.EventPVCBound},
+		},
+		{
+			description: "WHEN pod is scheduled THEN PodScheduled is sent once",
+			pods:        []watch.Event{pod(apiv1.ConditionFalse), pod(apiv1.ConditionTrue), pod(apiv1.ConditionTrue)},
+			expected:    []models.EventType{models.EventPodScheduled},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			deployments, claims, pods := make(chan watch.Event), make(chan watch.Event), make(chan watch.Event)
+			events := make(chan models.WatchEvent, 10)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				newInstanceWatcher("id", events).run(context.Background(), deployments, claims, pods)
+			}()
+			feed := func(in chan<- watch.Event, incoming []watch.Event) bool {
+				for _, event := range incoming {
+					select {
+					case in <- event:
+					case <-done:
+						return false
+					}
+				}
+				return true
+			}
+			_ = feed(deployments, tc.deployments) && feed(claims, tc.claims) && feed(pods, tc.pods)
+			close(deployments)
+			<-done
+			close(events)
+			var got []models.EventType
+			for event := range events {
+				got = append(got, event.Type)
+			}
+			if len(got) != len(tc.expected) {
+				t.Fatalf("expected events = %v, got %v", tc.expected, got)
+			}
+			for idx := range got {
+				if got[idx] != tc.expected[idx] {
+					t.Errorf("expected events = %v, got %v", tc.expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	workloadStatefulSet = "statefulset"
+	workloadDeployment  = "deployment" // Shared volume, only kept for instances created before StatefulSets
+)
+
+// workload is the part of the Deployment or StatefulSet running an instance read by Get, List and Watch
+type workload struct {
+	kind              string
+	name              string
+	uid               types.UID
+	namespace         string
+	labels            map[string]string
+	replicas          int32
+	readyReplicas     int32
+	availableReplicas int32
+	template          apiv1.PodTemplateSpec
+	claimTemplates    []apiv1.PersistentVolumeClaim
+	createdAt         time.Time
+	deletionTimestamp *metav1.Time
+}
+
+func fromDeployment(deployment *appsv1.Deployment) *workload {
+	result := &workload{
+		kind:              workloadDeployment,
+		name:              deployment.Name,
+		uid:               deployment.UID,
+		namespace:         deployment.Namespace,
+		labels:            deployment.Labels,
+		readyReplicas:     deployment.Status.ReadyReplicas,
+		availableReplicas: deployment.Status.AvailableReplicas,
+		template:          deployment.Spec.Template,
+		createdAt:         deployment.CreationTimestamp.Time,
+		deletionTimestamp: deployment.DeletionTimestamp,
+	}
+	if deployment.Spec.Replicas != nil {
+		result.replicas = *deployment.Spec.Replicas
+	}
+	return result
+}
+
+func fromStatefulSet(statefulSet *appsv1.StatefulSet) *workload {
+	result := &workload{
+		kind:              workloadStatefulSet,
+		name:              statefulSet.Name,
+		uid:               statefulSet.UID,
+		namespace:         statefulSet.Namespace,
+		labels:            statefulSet.Labels,
+		readyReplicas:     statefulSet.Status.ReadyReplicas,
+		availableReplicas: statefulSet.Status.AvailableReplicas,
+		template:          statefulSet.Spec.Template,
+		claimTemplates:    statefulSet.Spec.VolumeClaimTemplates,
+		createdAt:         statefulSet.CreationTimestamp.Time,
+		deletionTimestamp: statefulSet.DeletionTimestamp,
+	}
+	if statefulSet.Spec.Replicas != nil {
+		result.replicas = *statefulSet.Spec.Replicas
+	}
+	return result
+}
+
+// fromObject converts the objects received from the workload watches
+func fromObject(object runtime.Object) (*workload, bool) {
+	switch typed := object.(type) {
+	case *appsv1.Deployment:
+		return fromDeployment(typed), true
+	case *appsv1.StatefulSet:
+		return fromStatefulSet(typed), true
+	default:
+		return nil, false
+	}
+}
+
+// getWorkload looks up the StatefulSet of an instance, falling back to the Deployment of older instances
+func (s *Postgres) getWorkload(ctx context.Context, namespace, id string) (*workload, error) {
+	if c := s.config.Cache; c.isSynced() {
+		if statefulSet, err := c.statefulSets.StatefulSets(namespace).Get(id); err == nil {
+			return fromStatefulSet(statefulSet), nil
+		}
+		if deployment, err := c.deployments.Deployments(namespace).Get(id); err == nil {
+			return fromDeployment(deployment), nil
+		}
+	}
+	statefulSet, err := s.kubeClient.AppsV1().StatefulSets(namespace).Get(ctx, id, metav1.GetOptions{})
+	if err == nil {
+		return fromStatefulSet(statefulSet), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	deployment, err := s.kubeClient.AppsV1().Deployments(namespace).Get(ctx, id, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromDeployment(deployment), nil
+}
@@ -132,9 +132,20 @@ func (p *Prometheus) Collect(metrics chan<- prometheus.Metric) {
 const (
 	MetricDeploymentAccessTotal       = "deployment_access_total"
 	MetricDeploymentAccessFailedTotal = "deployment_access_failed_total"
+	MetricDeploymentRollbackTotal     = "deployment_rollback_total"
+	MetricReconcileTotal              = "instance_reconcile_total"
+	MetricReconcileFailedTotal        = "instance_reconcile_failed_total"
+	MetricDriftedObjects              = "instance_drifted_objects"
+	MetricDriftRepairedTotal          = "instance_drift_repaired_total"
+	MetricCacheStalenessSeconds       = "cache_staleness_seconds"
+	MetricLeader                      = "leader_election_leader"
 
 	LabelID        = "id"
 	LabelOperation = "operation"
+	LabelStep      = "step"
+	LabelKind      = "kind"
+	LabelResource  = "resource"
+	LabelLease     = "lease"
 )
 
 func GetMetricsDefinition() []Metric {
@@ -151,5 +162,47 @@ func GetMetricsDefinition() []Metric {
 			Description: "External deployment operation requested",
 			Labels:      []string{LabelID, LabelOperation},
 		},
+		{
+			Type:        Counter,
+			Name:        MetricDeploymentRollbackTotal,
+			Description: "Partially created deployment rolled back, labeled by the failed step",
+			Labels:      []string{LabelID, LabelStep},
+		},
+		{
+			Type:        Counter,
+			Name:        MetricReconcileTotal,
+			Description: "PostgresInstance reconciled by the controller",
+			Labels:      []string{LabelID},
+		},
+		{
+			Type:        Counter,
+			Name:        MetricReconcileFailedTotal,
+			Description: "PostgresInstance reconcile failed",
+			Labels:      []string{LabelID},
+		},
+		{
+			Type:        Gauge,
+			Name:        MetricDriftedObjects,
+			Description: "Objects of the instance differing from the generated ones at the last drift check",
+			Labels:      []string{LabelID},
+		},
+		{
+			Type:        Counter,
+			Name:        MetricDriftRepairedTotal,
+			Description: "Drifted object applied again, labeled by its kind",
+			Labels:      []string{LabelID, LabelKind},
+		},
+		{
+			Type:        Gauge,
+			Name:        MetricCacheStalenessSeconds,
+			Description: "Seconds since the informer cache of the resource last advanced its resource version",
+			Labels:      []string{LabelResource},
+		},
+		{
+			Type:        Gauge,
+			Name:        MetricLeader,
+			Description: "Whether this replica holds the Lease and runs the background loops",
+			Labels:      []string{LabelLease},
+		},
 	}
 }